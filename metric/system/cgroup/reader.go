@@ -18,6 +18,7 @@
 package cgroup
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
@@ -176,10 +177,22 @@ func (r *Reader) CgroupsVersion(pid int) (CgroupsVersion, error) {
 // GetStatsForPid is a generic method that returns a CGStats interface for V1 and V2
 // cgroup statistics. For applications that require raw metrics, use GetV*StatsForProcess()
 func (r *Reader) GetStatsForPid(pid int) (CGStats, error) {
+	return r.GetStatsForPidWithContext(context.Background(), pid)
+}
+
+// GetStatsForPidWithContext is GetStatsForPid, but returns the error of ctx instead of reading the cgroup files once ctx is done.
+// ctx is checked between the version lookup and the stats, a single read isn't interrupted.
+func (r *Reader) GetStatsForPidWithContext(ctx context.Context, pid int) (CGStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	v, err := r.CgroupsVersion(pid)
 	if err != nil {
 		return nil, fmt.Errorf("error finding cgroup version for pid %d: %w", pid, err)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if v == CgroupsV1 {
 		return r.GetV1StatsForProcess(pid)
 	}
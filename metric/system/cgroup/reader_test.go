@@ -21,6 +21,7 @@
 package cgroup
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -138,3 +139,18 @@ func TestReaderGetStatsHierarchyOverride(t *testing.T) {
 	require.NotNil(t, stats2.CPU, "no v2 cpu stats found")
 	require.NotZero(t, stats2.CPU.Stats.Usage.NS, "no v2 CPU usage stats")
 }
+
+func TestReaderGetStatsForPidWithContext(t *testing.T) {
+	reader, err := NewReader(resolve.NewTestResolver("testdata/docker"), true)
+	require.NoError(t, err, "error in NewReader")
+
+	stats, err := reader.GetStatsForPidWithContext(context.Background(), 985)
+	require.NoError(t, err, "error in GetStatsForPidWithContext")
+	require.Equal(t, CgroupsV1, stats.CGVersion())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats, err = reader.GetStatsForPidWithContext(ctx, 985)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Nil(t, stats)
+}
@@ -23,4 +23,100 @@ type IncludeTopConfig struct {
 	Enabled  bool `config:"enabled"`
 	ByCPU    int  `config:"by_cpu"`
 	ByMemory int  `config:"by_memory"`
+	// ByIO ranks processes by the per-second rate of bytes read from and written to the storage layer
+	ByIO int `config:"by_io"`
+	// ByPSS ranks processes by proportional set size. This requires Stats.EnableSmaps.
+	ByPSS int `config:"by_pss"`
+	// ByOOMRisk ranks processes by how likely they are to be killed by the OOM killer, see ProcOOMInfo.
+	// Processes in the memory cgroups with the least headroom come first, which requires Stats.EnableCgroups.
+	ByOOMRisk int `config:"by_oom_risk"`
 }
+
+// GroupBy is the key that Stats.Get groups processes by
+type GroupBy string
+
+var (
+	// GroupByName groups processes with the same name
+	GroupByName GroupBy = "name"
+	// GroupByExe groups processes with the same executable path
+	GroupByExe GroupBy = "exe"
+	// GroupByUsername groups processes that run as the same user
+	GroupByUsername GroupBy = "username"
+	// GroupByCgroup groups processes in the same cgroup. This requires Stats.EnableCgroups.
+	GroupByCgroup GroupBy = "cgroup"
+)
+
+// FilterConfig is a process filter expression, used to select the processes reported by Stats.
+// Every field that is set must match, so a single FilterConfig acts as an "and" of its fields.
+// String fields are regular expressions.
+type FilterConfig struct {
+	And []FilterConfig `config:"and"`
+	Or  []FilterConfig `config:"or"`
+	Not *FilterConfig  `config:"not"`
+
+	Name     string `config:"name"`
+	Username string `config:"username"`
+	Exe      string `config:"exe"`
+	Cmdline  string `config:"cmdline"`
+	// Cgroup matches any of the cgroup paths listed in /proc/PID/cgroup
+	Cgroup string `config:"cgroup"`
+	// State matches any of the given process states, such as "zombie" or "disk_sleep"
+	State []string `config:"state"`
+	Ppid  *int     `config:"ppid"`
+	// AncestorPid matches processes that have the given PID anywhere in their parent chain
+	AncestorPid *int `config:"ancestor_pid"`
+	// Metric is a threshold on a process metric, such as "memory.rss.bytes > 500MB" or "cpu.total.pct >= 50%"
+	Metric string `config:"metric"`
+}
+
+// RedactConfig configures the redaction of secrets in environment variables, arguments and command lines.
+// Secrets are replaced with a placeholder, or a salted hash if Hash is set.
+type RedactConfig struct {
+	// Keys are case-insensitive glob patterns of environment variable names and command line flags
+	// whose values are secrets, such as "*TOKEN*". DefaultRedactKeys is used if this is empty.
+	Keys []string `config:"keys"`
+	// Values are regular expressions that match secrets anywhere in values and arguments.
+	// If the expression has a capture group, only the group is redacted. DefaultRedactValues is used if this is empty.
+	Values []string `config:"values"`
+	// Hash replaces each secret with a hash of Salt and the secret, so equal secrets can still be correlated
+	Hash bool   `config:"hash"`
+	Salt string `config:"salt"`
+}
+
+var (
+	// DefaultRedactKeys are the key patterns used if RedactConfig.Keys is empty
+	DefaultRedactKeys = []string{"*TOKEN*", "*PASSWORD*", "*PASSWD*", "*SECRET*", "*API_KEY*", "*APIKEY*", "*CREDENTIAL*", "*PRIVATE_KEY*"}
+	// DefaultRedactValues are the value patterns used if RedactConfig.Values is empty.
+	// They match bearer tokens, AWS access key IDs and the password of URLs with credentials.
+	DefaultRedactValues = []string{
+		`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`,
+		`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+		`[a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]+:([^@/\s]+)@`,
+	}
+)
+
+// MapsConfig configures the summary of the memory mappings of processes
+type MapsConfig struct {
+	// TopN is the number of largest mappings that are reported for every process. Defaults to DefaultMapsTopN.
+	TopN int `config:"top_n"`
+}
+
+// DefaultMapsTopN is the default MapsConfig.TopN
+const DefaultMapsTopN = 10
+
+// ExeHashConfig configures the hashing of the executables of processes
+type ExeHashConfig struct {
+	// Algorithms are the hashes to compute, any of "sha256", "sha1" and "md5". Defaults to sha256.
+	Algorithms []string `config:"algorithms"`
+	// MaxFileSize is the size in bytes of the largest executable that is hashed. Defaults to DefaultExeHashMaxFileSize.
+	MaxFileSize int64 `config:"max_file_size"`
+	// CacheSize is the number of executables whose hashes are kept between cycles. Defaults to DefaultExeHashCacheSize.
+	CacheSize int `config:"cache_size"`
+}
+
+const (
+	// DefaultExeHashMaxFileSize is the default ExeHashConfig.MaxFileSize
+	DefaultExeHashMaxFileSize = 100 * 1024 * 1024
+	// DefaultExeHashCacheSize is the default ExeHashConfig.CacheSize
+	DefaultExeHashCacheSize = 512
+)
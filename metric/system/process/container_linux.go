@@ -0,0 +1,140 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+var (
+	// containerIDPattern matches a cgroup path component that holds a container ID,
+	// e.g. "docker-<id>.scope" with the systemd driver or "<id>" with the cgroupfs driver.
+	containerIDPattern = regexp.MustCompile(`^(docker-|cri-containerd-|crio-|libpod-)?([0-9a-f]{64})(\.scope)?$`)
+	// lxcPattern matches the cgroups of LXC containers, "/lxc/<name>" or "/lxc.payload.<name>" on newer versions
+	lxcPattern = regexp.MustCompile(`^/lxc(?:\.payload)?[./]([^/]+)`)
+	// podUIDPattern matches the pod cgroup of kubernetes. The systemd driver replaces the dashes with underscores.
+	podUIDPattern = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+)
+
+// containerRuntimes maps the prefixes of container cgroups to the runtime names
+var containerRuntimes = map[string]string{
+	"docker-":         "docker",
+	"cri-containerd-": "containerd",
+	"crio-":           "cri-o",
+	"libpod-":         "podman",
+}
+
+// namespaceTypes are the namespaces reported in ProcNamespaces
+var namespaceTypes = []struct {
+	name  string
+	field func(*ProcNamespaces) *opt.Uint
+}{
+	{"pid", func(ns *ProcNamespaces) *opt.Uint { return &ns.Pid }},
+	{"net", func(ns *ProcNamespaces) *opt.Uint { return &ns.Net }},
+	{"mnt", func(ns *ProcNamespaces) *opt.Uint { return &ns.Mnt }},
+	{"uts", func(ns *ProcNamespaces) *opt.Uint { return &ns.Uts }},
+	{"ipc", func(ns *ProcNamespaces) *opt.Uint { return &ns.Ipc }},
+	{"user", func(ns *ProcNamespaces) *opt.Uint { return &ns.User }},
+	{"cgroup", func(ns *ProcNamespaces) *opt.Uint { return &ns.Cgroup }},
+}
+
+// getNamespaces reads the namespace inode numbers from the /proc/[PID]/ns links, e.g. "net:[4026531992]".
+// Reading the links requires ptrace access to the process, so permission errors are ignored,
+// as are namespaces that don't exist on this kernel.
+func getNamespaces(hostfs resolve.Resolver, pid int) (ProcNamespaces, error) {
+	namespaces := ProcNamespaces{}
+	for _, ns := range namespaceTypes {
+		path := hostfs.Join("proc", strconv.Itoa(pid), "ns", ns.name)
+		link, err := os.Readlink(path)
+		if errors.Is(err, os.ErrPermission) || errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return namespaces, fmt.Errorf("error reading link %s: %w", path, err)
+		}
+
+		prefix := ns.name + ":["
+		if !strings.HasPrefix(link, prefix) || !strings.HasSuffix(link, "]") {
+			return namespaces, fmt.Errorf("unexpected namespace link '%s' for %s", link, path)
+		}
+		inode, err := strconv.ParseUint(link[len(prefix):len(link)-1], 10, 64)
+		if err != nil {
+			return namespaces, fmt.Errorf("error parsing namespace inode from '%s': %w", link, err)
+		}
+		*ns.field(&namespaces) = opt.UintWith(inode)
+	}
+	return namespaces, nil
+}
+
+// getContainer returns the container a process runs in, based on its cgroup paths.
+func getContainer(reader *cgroup.Reader, pid int) (ProcContainer, error) {
+	paths, err := reader.ProcessCgroupPaths(pid)
+	if err != nil {
+		return ProcContainer{}, fmt.Errorf("error fetching cgroup paths for pid %d: %w", pid, err)
+	}
+
+	for _, path := range paths.Flatten() {
+		if container := containerFromCgroupPath(path.ControllerPath); !container.IsZero() {
+			return container, nil
+		}
+	}
+	return ProcContainer{}, nil
+}
+
+// containerFromCgroupPath derives the container runtime, container ID and kubernetes pod UID from a cgroup path
+func containerFromCgroupPath(path string) ProcContainer {
+	container := ProcContainer{}
+
+	if match := lxcPattern.FindStringSubmatch(path); match != nil {
+		container.Runtime = "lxc"
+		container.ID = match[1]
+		return container
+	}
+
+	if match := podUIDPattern.FindStringSubmatch(path); match != nil {
+		container.PodUID = strings.ReplaceAll(match[1], "_", "-")
+	}
+
+	// the container is the innermost cgroup with an ID, the processes in a container can create nested cgroups
+	parts := strings.Split(path, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		match := containerIDPattern.FindStringSubmatch(parts[i])
+		if match == nil {
+			continue
+		}
+		container.ID = match[2]
+		container.Runtime = containerRuntimes[match[1]]
+		if container.Runtime == "" && i > 0 && parts[i-1] == "docker" {
+			container.Runtime = "docker"
+		}
+		break
+	}
+
+	return container
+}
@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestContainerFromCgroupPath(t *testing.T) {
+	const id = "b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
+	tests := []struct {
+		path     string
+		expected ProcContainer
+	}{
+		{"/docker/" + id, ProcContainer{Runtime: "docker", ID: id}},
+		{"/system.slice/docker-" + id + ".scope", ProcContainer{Runtime: "docker", ID: id}},
+		{"/machine.slice/libpod-" + id + ".scope/container", ProcContainer{Runtime: "podman", ID: id}},
+		{
+			"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0a1b2c3d_4e5f_6789_abcd_ef0123456789.slice/cri-containerd-" + id + ".scope",
+			ProcContainer{Runtime: "containerd", ID: id, PodUID: "0a1b2c3d-4e5f-6789-abcd-ef0123456789"},
+		},
+		{
+			"/kubepods/besteffort/pod0a1b2c3d-4e5f-6789-abcd-ef0123456789/crio-" + id,
+			ProcContainer{Runtime: "cri-o", ID: id, PodUID: "0a1b2c3d-4e5f-6789-abcd-ef0123456789"},
+		},
+		// the cgroupfs driver doesn't tell the runtime
+		{
+			"/kubepods/besteffort/pod0a1b2c3d-4e5f-6789-abcd-ef0123456789/" + id,
+			ProcContainer{ID: id, PodUID: "0a1b2c3d-4e5f-6789-abcd-ef0123456789"},
+		},
+		{"/lxc/web01", ProcContainer{Runtime: "lxc", ID: "web01"}},
+		{"/lxc.payload.web01/init.scope", ProcContainer{Runtime: "lxc", ID: "web01"}},
+		{"/user.slice/user-1000.slice/session-2.scope", ProcContainer{}},
+		{"/", ProcContainer{}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, containerFromCgroupPath(test.path), test.path)
+	}
+}
+
+func TestGetContainer(t *testing.T) {
+	reader, err := cgroup.NewReader(resolve.NewTestResolver("../cgroup/testdata/docker"), false)
+	require.NoError(t, err)
+
+	container, err := getContainer(reader, 985)
+	require.NoError(t, err)
+	assert.Equal(t, "docker", container.Runtime)
+	assert.Equal(t, "b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242", container.ID)
+
+	// not in a container
+	container, err = getContainer(reader, 1)
+	require.NoError(t, err)
+	assert.True(t, container.IsZero())
+}
+
+func TestGetNamespaces(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "proc", "42", "ns")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.Symlink("net:[4026531992]", filepath.Join(dir, "net")))
+	require.NoError(t, os.Symlink("pid:[4026531836]", filepath.Join(dir, "pid")))
+
+	namespaces, err := getNamespaces(resolve.NewTestResolver(root), 42)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4026531992), namespaces.Net.ValueOr(0))
+	assert.Equal(t, uint64(4026531836), namespaces.Pid.ValueOr(0))
+	// missing on older kernels
+	assert.False(t, namespaces.Cgroup.Exists())
+
+	require.NoError(t, os.Symlink("garbage", filepath.Join(dir, "uts")))
+	_, err = getNamespaces(resolve.NewTestResolver(root), 42)
+	assert.Error(t, err)
+
+	// namespaces of the test process
+	namespaces, err = getNamespaces(resolve.NewTestResolver("/"), os.Getpid())
+	require.NoError(t, err)
+	assert.True(t, namespaces.Pid.Exists())
+	assert.True(t, namespaces.Net.Exists())
+}
+
+func TestGetOneContainer(t *testing.T) {
+	testConfig := Stats{
+		Procs:           []string{".*"},
+		Hostfs:          resolve.NewTestResolver("/"),
+		EnableContainer: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	pidData, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	nsPid, err := pidData.GetValue("namespaces.pid")
+	require.NoError(t, err)
+	assert.NotZero(t, nsPid)
+}
@@ -0,0 +1,43 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"fmt"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getProcUID returns the real UID of a process from /proc/[PID]/status
+func getProcUID(hostfs resolve.Resolver, pid int) (int, error) {
+	status, err := getProcStatus(hostfs, pid)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := parseStatusIDs(status["Uid"])
+	if err != nil {
+		return 0, fmt.Errorf("error parsing Uid for pid %d: %w", pid, err)
+	}
+	if !ids.Real.Exists() {
+		return 0, fmt.Errorf("field Uid not found in proc status for pid %d", pid)
+	}
+	return ids.Real.ValueOr(0), nil
+}
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// exeFileKey identifies a version of an executable. A binary that is replaced on disk gets a new inode or mtime.
+type exeFileKey struct {
+	dev   uint64
+	inode uint64
+	mtime int64
+	size  int64
+}
+
+// exeHasher hashes executables, and keeps the hashes of the most recently used ones in an LRU cache.
+type exeHasher struct {
+	algorithms  []string
+	maxFileSize int64
+
+	mut      sync.Mutex
+	capacity int
+	lru      *list.List // of *exeHashEntry, most recently used first
+	entries  map[exeFileKey]*list.Element
+}
+
+type exeHashEntry struct {
+	key  exeFileKey
+	hash ProcExeHash
+}
+
+// newExeHasher validates an ExeHashConfig and creates its cache
+func newExeHasher(cfg ExeHashConfig) (*exeHasher, error) {
+	h := &exeHasher{
+		algorithms:  cfg.Algorithms,
+		maxFileSize: cfg.MaxFileSize,
+		capacity:    cfg.CacheSize,
+		lru:         list.New(),
+		entries:     map[exeFileKey]*list.Element{},
+	}
+	if len(h.algorithms) == 0 {
+		h.algorithms = []string{"sha256"}
+	}
+	for _, algorithm := range h.algorithms {
+		switch algorithm {
+		case "sha256", "sha1", "md5":
+		default:
+			return nil, fmt.Errorf("unknown hash algorithm '%s'", algorithm)
+		}
+	}
+	if h.maxFileSize <= 0 {
+		h.maxFileSize = DefaultExeHashMaxFileSize
+	}
+	if h.capacity <= 0 {
+		h.capacity = DefaultExeHashCacheSize
+	}
+	return h, nil
+}
+
+// get returns the cached hashes of an executable
+func (h *exeHasher) get(key exeFileKey) (ProcExeHash, bool) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	elem, ok := h.entries[key]
+	if !ok {
+		return ProcExeHash{}, false
+	}
+	h.lru.MoveToFront(elem)
+	return elem.Value.(*exeHashEntry).hash, true
+}
+
+// put caches the hashes of an executable, and evicts the least recently used one if the cache is full
+func (h *exeHasher) put(key exeFileKey, hash ProcExeHash) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	if elem, ok := h.entries[key]; ok {
+		elem.Value.(*exeHashEntry).hash = hash
+		h.lru.MoveToFront(elem)
+		return
+	}
+	h.entries[key] = h.lru.PushFront(&exeHashEntry{key: key, hash: hash})
+	if h.lru.Len() > h.capacity {
+		oldest := h.lru.Back()
+		h.lru.Remove(oldest)
+		delete(h.entries, oldest.Value.(*exeHashEntry).key)
+	}
+}
@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"crypto/md5"  //nolint:gosec // md5 is only used for compatibility with other tools
+	"crypto/sha1" //nolint:gosec // sha1 is only used for compatibility with other tools
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getExeInfo fetches the file metadata and the hashes of the executable of a process.
+// The file is opened through /proc/[PID]/exe, so binaries that were deleted or replaced on disk can still be hashed.
+// This requires ptrace access to the process, so permission errors are ignored.
+func getExeInfo(hostfs resolve.Resolver, pid int, hasher *exeHasher) (ProcExeInfo, error) {
+	info := ProcExeInfo{}
+
+	path := hostfs.Join("proc", strconv.Itoa(pid), "exe")
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrPermission) || errors.Is(err, os.ErrNotExist) { // kernel threads don't have an executable
+		return info, nil
+	} else if err != nil {
+		return info, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if link, err := os.Readlink(path); err == nil {
+		info.Deleted = strings.HasSuffix(link, " (deleted)")
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return info, fmt.Errorf("error reading file info of %s: %w", path, err)
+	}
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info, fmt.Errorf("unexpected file info type %T for %s", stat.Sys(), path)
+	}
+	info.Size = opt.UintWith(uint64(stat.Size()))
+	info.Mtime = unixTimeMsToTime(uint64(stat.ModTime().UnixNano() / 1e6))
+	info.Inode = opt.UintWith(sys.Ino)
+	info.Device = opt.UintWith(uint64(sys.Dev)) //nolint:unconvert // Dev is 32 bits on some platforms
+
+	if stat.Size() > hasher.maxFileSize {
+		return info, nil
+	}
+	key := exeFileKey{dev: info.Device.ValueOr(0), inode: sys.Ino, mtime: stat.ModTime().UnixNano(), size: stat.Size()}
+	if hash, ok := hasher.get(key); ok {
+		info.Hash = hash
+		return info, nil
+	}
+
+	info.Hash, err = hashFile(file, hasher.algorithms)
+	if err != nil {
+		return info, fmt.Errorf("error hashing %s: %w", path, err)
+	}
+	hasher.put(key, info.Hash)
+	return info, nil
+}
+
+// hashFile computes the given hashes of a file in a single pass
+func hashFile(file io.Reader, algorithms []string) (ProcExeHash, error) {
+	hashes := map[string]hash.Hash{}
+	writers := []io.Writer{}
+	for _, algorithm := range algorithms {
+		var h hash.Hash
+		switch algorithm {
+		case "sha256":
+			h = sha256.New()
+		case "sha1":
+			h = sha1.New() //nolint:gosec // see import
+		case "md5":
+			h = md5.New() //nolint:gosec // see import
+		}
+		hashes[algorithm] = h
+		writers = append(writers, h)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return ProcExeHash{}, err
+	}
+
+	result := ProcExeHash{}
+	for algorithm, h := range hashes {
+		sum := hex.EncodeToString(h.Sum(nil))
+		switch algorithm {
+		case "sha256":
+			result.SHA256 = sum
+		case "sha1":
+			result.SHA1 = sum
+		case "md5":
+			result.MD5 = sum
+		}
+	}
+	return result, nil
+}
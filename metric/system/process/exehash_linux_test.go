@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"crypto/md5" //nolint:gosec // used to check the md5 hash
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetExeInfo(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep is needed to run a test process")
+	}
+
+	// run a copy of sleep, so it can be deleted while it runs
+	exe := filepath.Join(t.TempDir(), "sleep")
+	data, err := os.ReadFile(sleep)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(exe, data, 0o755))
+	cmd := exec.Command(exe, "60")
+	require.NoError(t, cmd.Start())
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	hasher, err := newExeHasher(ExeHashConfig{Algorithms: []string{"sha256", "md5"}})
+	require.NoError(t, err)
+	info, err := getExeInfo(resolve.NewTestResolver("/"), cmd.Process.Pid, hasher)
+	require.NoError(t, err)
+
+	sha := sha256.Sum256(data)
+	md := md5.Sum(data) //nolint:gosec // see import
+	assert.Equal(t, hex.EncodeToString(sha[:]), info.Hash.SHA256)
+	assert.Equal(t, hex.EncodeToString(md[:]), info.Hash.MD5)
+	assert.Empty(t, info.Hash.SHA1)
+	assert.Equal(t, uint64(len(data)), info.Size.ValueOr(0))
+	assert.True(t, info.Inode.Exists())
+	assert.NotEmpty(t, info.Mtime)
+	assert.False(t, info.Deleted)
+	assert.Equal(t, 1, hasher.lru.Len())
+
+	// the deleted binary can still be hashed through /proc/PID/exe
+	require.NoError(t, os.Remove(exe))
+	deleted, err := getExeInfo(resolve.NewTestResolver("/"), cmd.Process.Pid, hasher)
+	require.NoError(t, err)
+	assert.True(t, deleted.Deleted)
+	assert.Equal(t, info.Hash, deleted.Hash)
+	assert.Equal(t, 1, hasher.lru.Len(), "the hash should come from the cache")
+
+	// binaries over the size limit aren't hashed
+	hasher.maxFileSize = 1
+	big, err := getExeInfo(resolve.NewTestResolver("/"), cmd.Process.Pid, hasher)
+	require.NoError(t, err)
+	assert.True(t, big.Hash.IsZero())
+	assert.True(t, big.Size.Exists())
+}
+
+func TestHashFile(t *testing.T) {
+	hash, err := hashFile(strings.NewReader("abc"), []string{"sha1"})
+	require.NoError(t, err)
+	assert.Equal(t, "a9993e364706816aba3e25717850c26c9cd0d89d", hash.SHA1)
+	assert.Empty(t, hash.SHA256)
+}
+
+func TestGetOneExeHash(t *testing.T) {
+	testConfig := Stats{
+		Procs:   []string{".*"},
+		Hostfs:  resolve.NewTestResolver("/"),
+		ExeHash: &ExeHashConfig{},
+	}
+	require.NoError(t, testConfig.Init())
+
+	pidData, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	sha, err := pidData.GetValue("exe_info.hash.sha256")
+	require.NoError(t, err)
+	assert.Len(t, sha, sha256.Size*2)
+}
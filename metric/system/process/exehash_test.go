@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExeHasher(t *testing.T) {
+	hasher, err := newExeHasher(ExeHashConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256"}, hasher.algorithms)
+	assert.Equal(t, int64(DefaultExeHashMaxFileSize), hasher.maxFileSize)
+	assert.Equal(t, DefaultExeHashCacheSize, hasher.capacity)
+
+	_, err = newExeHasher(ExeHashConfig{Algorithms: []string{"sha256", "crc32"}})
+	assert.Error(t, err)
+}
+
+func TestExeHasherCache(t *testing.T) {
+	hasher, err := newExeHasher(ExeHashConfig{CacheSize: 2})
+	require.NoError(t, err)
+
+	first, second, third := exeFileKey{inode: 1}, exeFileKey{inode: 2}, exeFileKey{inode: 3}
+	hasher.put(first, ProcExeHash{SHA256: "1"})
+	hasher.put(second, ProcExeHash{SHA256: "2"})
+	// using the first entry makes the second one the oldest
+	_, ok := hasher.get(first)
+	require.True(t, ok)
+	hasher.put(third, ProcExeHash{SHA256: "3"})
+
+	_, ok = hasher.get(second)
+	assert.False(t, ok)
+	hash, ok := hasher.get(first)
+	assert.True(t, ok)
+	assert.Equal(t, "1", hash.SHA256)
+	_, ok = hasher.get(third)
+	assert.True(t, ok)
+
+	// a binary replaced in place has a new mtime
+	_, ok = hasher.get(exeFileKey{inode: 1, mtime: 1})
+	assert.False(t, ok)
+}
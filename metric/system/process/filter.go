@@ -0,0 +1,415 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elastic/elastic-agent-libs/match"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
+)
+
+// maxAncestorDepth limits how far up the parent chain an ancestor_pid filter will look
+const maxAncestorDepth = 64
+
+// processFilter is a compiled FilterConfig.
+type processFilter interface {
+	// match returns whether the process matches the filter, and whether that result is known.
+	// Before a process is filled out with FillPidMetrics, final is false and
+	// filters on data that isn't available yet return an unknown result.
+	// Once final is true, missing data is treated as a non-match.
+	match(proc *filterProcess, final bool) (matched bool, known bool)
+}
+
+// filterProcess wraps the process being filtered, and lazily fetches the data that isn't part of ProcState
+type filterProcess struct {
+	state *ProcState
+	// cgroups is used to read the cgroup paths of the process, it's only set if the filter matches on cgroups.
+	cgroups *cgroup.Reader
+	// ppids looks up the parent PID of other processes for ancestor_pid filters.
+	ppids *ppidCache
+
+	cgroupPaths []string
+	cgroupRead  bool
+}
+
+// ppidCache caches the parent PIDs of processes, so ancestor_pid filters only need to look up a process once per cycle.
+type ppidCache struct {
+	mut   sync.Mutex
+	ppids map[int]int
+	// lookup fetches the parent PID of a process that isn't in the cache.
+	lookup func(pid int) (int, bool)
+}
+
+func newPpidCache(lookup func(pid int) (int, bool)) *ppidCache {
+	return &ppidCache{ppids: make(map[int]int), lookup: lookup}
+}
+
+// set stores the parent PID of a process that has already been fetched.
+func (c *ppidCache) set(pid, ppid int) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.ppids[pid] = ppid
+}
+
+// get returns the parent PID of a process. Processes that couldn't be looked up are cached as not having a parent.
+func (c *ppidCache) get(pid int) (int, bool) {
+	c.mut.Lock()
+	ppid, ok := c.ppids[pid]
+	c.mut.Unlock()
+	if ok {
+		return ppid, ppid > 0
+	}
+
+	ppid, ok = c.lookup(pid)
+	if !ok {
+		ppid = 0
+	}
+	c.set(pid, ppid)
+	return ppid, ok
+}
+
+type filterAnd []processFilter
+
+func (f filterAnd) match(proc *filterProcess, final bool) (bool, bool) {
+	allKnown := true
+	for _, sub := range f {
+		matched, known := sub.match(proc, final)
+		if known && !matched {
+			return false, true
+		}
+		allKnown = allKnown && known
+	}
+	return true, allKnown
+}
+
+type filterOr []processFilter
+
+func (f filterOr) match(proc *filterProcess, final bool) (bool, bool) {
+	allKnown := true
+	for _, sub := range f {
+		matched, known := sub.match(proc, final)
+		if known && matched {
+			return true, true
+		}
+		allKnown = allKnown && known
+	}
+	return false, allKnown
+}
+
+type filterNot struct {
+	filter processFilter
+}
+
+func (f filterNot) match(proc *filterProcess, final bool) (bool, bool) {
+	matched, known := f.filter.match(proc, final)
+	return !matched, known
+}
+
+// filterFunc is a leaf of the filter tree.
+type filterFunc func(proc *filterProcess, final bool) (bool, bool)
+
+func (f filterFunc) match(proc *filterProcess, final bool) (bool, bool) {
+	return f(proc, final)
+}
+
+// usesCgroups returns true if the filter or any of its sub-expressions matches on cgroup paths.
+func (cfg FilterConfig) usesCgroups() bool {
+	if cfg.Cgroup != "" || (cfg.Not != nil && cfg.Not.usesCgroups()) {
+		return true
+	}
+	for _, sub := range cfg.And {
+		if sub.usesCgroups() {
+			return true
+		}
+	}
+	for _, sub := range cfg.Or {
+		if sub.usesCgroups() {
+			return true
+		}
+	}
+	return false
+}
+
+// compileFilter compiles a FilterConfig and all of its sub-expressions
+func compileFilter(cfg FilterConfig) (processFilter, error) {
+	var filters filterAnd
+
+	for _, sub := range cfg.And {
+		subFilter, err := compileFilter(sub)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling 'and' filter: %w", err)
+		}
+		filters = append(filters, subFilter)
+	}
+
+	if len(cfg.Or) > 0 {
+		or := filterOr{}
+		for _, sub := range cfg.Or {
+			subFilter, err := compileFilter(sub)
+			if err != nil {
+				return nil, fmt.Errorf("error compiling 'or' filter: %w", err)
+			}
+			or = append(or, subFilter)
+		}
+		filters = append(filters, or)
+	}
+
+	if cfg.Not != nil {
+		subFilter, err := compileFilter(*cfg.Not)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling 'not' filter: %w", err)
+		}
+		filters = append(filters, filterNot{filter: subFilter})
+	}
+
+	stringFilters := []struct {
+		name    string
+		pattern string
+		value   func(proc *filterProcess) string
+	}{
+		{"name", cfg.Name, func(proc *filterProcess) string { return proc.state.Name }},
+		{"username", cfg.Username, func(proc *filterProcess) string { return proc.state.Username }},
+		{"exe", cfg.Exe, func(proc *filterProcess) string { return proc.state.Exe }},
+		{"cmdline", cfg.Cmdline, func(proc *filterProcess) string {
+			if proc.state.Cmdline != "" {
+				return proc.state.Cmdline
+			}
+			return strings.Join(proc.state.Args, " ")
+		}},
+	}
+	for _, strFilter := range stringFilters {
+		if strFilter.pattern == "" {
+			continue
+		}
+		matcher, err := match.Compile(strFilter.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile %s regexp [%s]: %w", strFilter.name, strFilter.pattern, err)
+		}
+		value := strFilter.value
+		filters = append(filters, filterFunc(func(proc *filterProcess, final bool) (bool, bool) {
+			str := value(proc)
+			if str == "" {
+				return false, final
+			}
+			return matcher.MatchString(str), true
+		}))
+	}
+
+	if cfg.Cgroup != "" {
+		matcher, err := match.Compile(cfg.Cgroup)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile cgroup regexp [%s]: %w", cfg.Cgroup, err)
+		}
+		filters = append(filters, filterFunc(func(proc *filterProcess, _ bool) (bool, bool) {
+			for _, path := range proc.getCgroupPaths() {
+				if matcher.MatchString(path) {
+					return true, true
+				}
+			}
+			return false, true
+		}))
+	}
+
+	if len(cfg.State) > 0 {
+		states := make(map[PidState]struct{}, len(cfg.State))
+		for _, state := range cfg.State {
+			states[PidState(state)] = struct{}{}
+		}
+		filters = append(filters, filterFunc(func(proc *filterProcess, final bool) (bool, bool) {
+			if proc.state.State == "" {
+				return false, final
+			}
+			_, ok := states[proc.state.State]
+			return ok, true
+		}))
+	}
+
+	if cfg.Ppid != nil {
+		ppid := *cfg.Ppid
+		filters = append(filters, filterFunc(func(proc *filterProcess, final bool) (bool, bool) {
+			if !proc.state.Ppid.Exists() {
+				return false, final
+			}
+			return proc.state.Ppid.ValueOr(0) == ppid, true
+		}))
+	}
+
+	if cfg.AncestorPid != nil {
+		ancestor := *cfg.AncestorPid
+		filters = append(filters, filterFunc(func(proc *filterProcess, final bool) (bool, bool) {
+			if !proc.state.Ppid.Exists() {
+				return false, final
+			}
+			return proc.hasAncestor(ancestor), true
+		}))
+	}
+
+	if cfg.Metric != "" {
+		threshold, err := compileMetricFilter(cfg.Metric)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, threshold)
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil, errors.New("empty process filter")
+	case 1:
+		return filters[0], nil
+	}
+	return filters, nil
+}
+
+// filterMetrics are the metrics that can be used in a `metric` filter, named after their fields in the process event.
+var filterMetrics = map[string]func(ProcState) (float64, bool){
+	"cpu.total.pct": func(p ProcState) (float64, bool) {
+		return p.CPU.Total.Pct.ValueOr(0), p.CPU.Total.Pct.Exists()
+	},
+	"cpu.total.norm.pct": func(p ProcState) (float64, bool) {
+		return p.CPU.Total.Norm.Pct.ValueOr(0), p.CPU.Total.Norm.Pct.Exists()
+	},
+	"memory.size": func(p ProcState) (float64, bool) {
+		return float64(p.Memory.Size.ValueOr(0)), p.Memory.Size.Exists()
+	},
+	"memory.rss.bytes": func(p ProcState) (float64, bool) {
+		return float64(p.Memory.Rss.Bytes.ValueOr(0)), p.Memory.Rss.Bytes.Exists()
+	},
+	"memory.share": func(p ProcState) (float64, bool) {
+		return float64(p.Memory.Share.ValueOr(0)), p.Memory.Share.Exists()
+	},
+	"memory.pss": func(p ProcState) (float64, bool) {
+		return float64(p.Memory.Pss.ValueOr(0)), p.Memory.Pss.Exists()
+	},
+	"fd.open": func(p ProcState) (float64, bool) {
+		return float64(p.FD.Open.ValueOr(0)), p.FD.Open.Exists()
+	},
+	"io.per_sec.read_bytes": func(p ProcState) (float64, bool) {
+		return p.IO.PerSec.ReadBytes.ValueOr(0), p.IO.PerSec.ReadBytes.Exists()
+	},
+	"io.per_sec.write_bytes": func(p ProcState) (float64, bool) {
+		return p.IO.PerSec.WriteBytes.ValueOr(0), p.IO.PerSec.WriteBytes.Exists()
+	},
+}
+
+var filterOperators = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// compileMetricFilter compiles a threshold expression in the form of `<metric> <operator> <value>`
+func compileMetricFilter(expr string) (processFilter, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("metric filter '%s' must be in the form of '<metric> <operator> <value>'", expr)
+	}
+
+	metric, ok := filterMetrics[fields[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric '%s' in filter '%s'", fields[0], expr)
+	}
+	operator, ok := filterOperators[fields[1]]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator '%s' in filter '%s'", fields[1], expr)
+	}
+	threshold, err := parseFilterValue(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing value in filter '%s': %w", expr, err)
+	}
+
+	return filterFunc(func(proc *filterProcess, final bool) (bool, bool) {
+		value, ok := metric(*proc.state)
+		if !ok {
+			return false, final
+		}
+		return operator(value, threshold), true
+	}), nil
+}
+
+// parseFilterValue parses a number with an optional percent or byte size suffix, such as 50% or 500MB.
+func parseFilterValue(in string) (float64, error) {
+	str := strings.ToUpper(in)
+	multiplier := 1.0
+	if strings.HasSuffix(str, "%") {
+		str = strings.TrimSuffix(str, "%")
+		multiplier = 0.01
+	} else {
+		for i, unit := range []string{"KB", "MB", "GB", "TB"} {
+			if strings.HasSuffix(str, unit) {
+				str = strings.TrimSuffix(str, unit)
+				multiplier = float64(uint64(1) << (10 * (i + 1)))
+				break
+			}
+		}
+	}
+
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing value '%s': %w", in, err)
+	}
+	return value * multiplier, nil
+}
+
+// getCgroupPaths returns the cgroup paths of the process.
+// Processes without readable cgroup data have no paths.
+func (proc *filterProcess) getCgroupPaths() []string {
+	if proc.cgroupRead || proc.cgroups == nil {
+		return proc.cgroupPaths
+	}
+	proc.cgroupRead = true
+
+	paths, err := proc.cgroups.ProcessCgroupPaths(proc.state.Pid.ValueOr(0))
+	if err != nil {
+		return nil
+	}
+	for _, path := range paths.Flatten() {
+		proc.cgroupPaths = append(proc.cgroupPaths, path.ControllerPath)
+	}
+	return proc.cgroupPaths
+}
+
+// hasAncestor walks up the parent chain of the process, looking for the given PID.
+func (proc *filterProcess) hasAncestor(ancestor int) bool {
+	ppid := proc.state.Ppid.ValueOr(0)
+	for depth := 0; depth < maxAncestorDepth && ppid > 0; depth++ {
+		if ppid == ancestor {
+			return true
+		}
+		if proc.ppids == nil {
+			return false
+		}
+		var ok bool
+		ppid, ok = proc.ppids.get(ppid)
+		if !ok {
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestCompileFilter(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     FilterConfig
+		wantErr bool
+	}{
+		{"single field", FilterConfig{Name: "nginx"}, false},
+		{"and", FilterConfig{And: []FilterConfig{{Name: "nginx"}, {Username: "root"}}}, false},
+		{"or", FilterConfig{Or: []FilterConfig{{Name: "nginx"}, {Name: "httpd"}}}, false},
+		{"not", FilterConfig{Not: &FilterConfig{State: []string{"zombie"}}}, false},
+		{"nested", FilterConfig{Or: []FilterConfig{{Not: &FilterConfig{Ppid: intPtr(2)}}, {Metric: "fd.open > 100"}}}, false},
+		{"empty", FilterConfig{}, true},
+		{"empty not", FilterConfig{Not: &FilterConfig{}}, true},
+		{"bad regexp", FilterConfig{Exe: "("}, true},
+		{"bad regexp in or", FilterConfig{Or: []FilterConfig{{Name: "nginx"}, {Cmdline: "[a-"}}}, true},
+		{"bad metric", FilterConfig{Metric: "memory.rss.bytes >"}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := compileFilter(tc.cfg)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCompileMetricFilter(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"memory.rss.bytes",
+		"memory.rss.bytes > 500MB extra",
+		"memory.unknown > 500MB",
+		"memory.rss.bytes => 500MB",
+		"memory.rss.bytes > lots",
+	} {
+		_, err := compileMetricFilter(expr)
+		assert.Error(t, err, "expression %q", expr)
+	}
+
+	_, err := compileMetricFilter("cpu.total.norm.pct >= 50%")
+	assert.NoError(t, err)
+}
+
+func TestParseFilterValue(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{"500MB", 500 * 1024 * 1024, false},
+		{"1.5gb", 1.5 * 1024 * 1024 * 1024, false},
+		{"2KB", 2048, false},
+		{"1TB", 1024 * 1024 * 1024 * 1024, false},
+		{"50%", 0.5, false},
+		{"100", 100, false},
+		{"MB", 0, true},
+		{"50%%", 0, true},
+		{"ten", 0, true},
+	}
+
+	for _, tc := range cases {
+		got, err := parseFilterValue(tc.in)
+		if tc.wantErr {
+			assert.Error(t, err, "value %q", tc.in)
+			continue
+		}
+		require.NoError(t, err, "value %q", tc.in)
+		assert.InDelta(t, tc.want, got, 1e-9, "value %q", tc.in)
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	// a process as returned by GetInfoForPid, before FillPidMetrics
+	partial := ProcState{
+		Name:  "nginx",
+		Pid:   opt.IntWith(100),
+		Ppid:  opt.IntWith(1),
+		State: Sleeping,
+	}
+	full := partial
+	full.Username = "www-data"
+	full.Exe = "/usr/sbin/nginx"
+	full.Args = []string{"nginx", "-g", "daemon off;"}
+	full.Memory.Rss.Bytes = opt.UintWith(600 * 1024 * 1024)
+
+	cases := []struct {
+		name      string
+		cfg       FilterConfig
+		proc      ProcState
+		final     bool
+		wantMatch bool
+		wantKnown bool
+	}{
+		{"name match", FilterConfig{Name: "^nginx$"}, partial, false, true, true},
+		{"name miss", FilterConfig{Name: "^httpd$"}, partial, false, false, true},
+		{"username before fill", FilterConfig{Username: "www-data"}, partial, false, false, false},
+		{"username after fill", FilterConfig{Username: "www-data"}, full, true, true, true},
+		{"missing username after fill", FilterConfig{Username: "www-data"}, partial, true, false, true},
+		{"cmdline from args", FilterConfig{Cmdline: "daemon off"}, full, true, true, true},
+		{"state", FilterConfig{State: []string{"zombie", "sleeping"}}, partial, false, true, true},
+		{"ppid", FilterConfig{Ppid: intPtr(1)}, partial, false, true, true},
+		{"metric before fill", FilterConfig{Metric: "memory.rss.bytes > 500MB"}, partial, false, false, false},
+		{"metric after fill", FilterConfig{Metric: "memory.rss.bytes > 500MB"}, full, true, true, true},
+		{"metric below threshold", FilterConfig{Metric: "memory.rss.bytes < 500MB"}, full, true, false, true},
+		{"missing metric after fill", FilterConfig{Metric: "cpu.total.pct > 10%"}, full, true, false, true},
+		// a known miss decides an "and", even if other fields are unknown
+		{"and known miss", FilterConfig{Name: "httpd", Username: "www-data"}, partial, false, false, true},
+		{"and unknown", FilterConfig{Name: "nginx", Username: "www-data"}, partial, false, true, false},
+		// a known match decides an "or", even if other fields are unknown
+		{"or known match", FilterConfig{Or: []FilterConfig{{Username: "www-data"}, {Name: "nginx"}}}, partial, false, true, true},
+		{"or unknown", FilterConfig{Or: []FilterConfig{{Username: "www-data"}, {Name: "httpd"}}}, partial, false, false, false},
+		{"not", FilterConfig{Not: &FilterConfig{State: []string{"zombie"}}}, partial, false, true, true},
+		{"not unknown", FilterConfig{Not: &FilterConfig{Exe: "nginx"}}, partial, false, true, false},
+		{"not after fill", FilterConfig{Not: &FilterConfig{Exe: "nginx"}}, full, true, false, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := compileFilter(tc.cfg)
+			require.NoError(t, err)
+			proc := tc.proc
+			matched, known := filter.match(&filterProcess{state: &proc}, tc.final)
+			assert.Equal(t, tc.wantKnown, known, "known")
+			if known {
+				assert.Equal(t, tc.wantMatch, matched, "matched")
+			}
+		})
+	}
+}
+
+func TestFilterAncestorPid(t *testing.T) {
+	// 1 -> 10 -> 20 -> 30
+	parents := map[int]int{10: 1, 20: 10, 30: 20}
+	lookups := 0
+	ppids := newPpidCache(func(pid int) (int, bool) {
+		lookups++
+		ppid, ok := parents[pid]
+		return ppid, ok
+	})
+
+	filter, err := compileFilter(FilterConfig{AncestorPid: intPtr(10)})
+	require.NoError(t, err)
+
+	for _, pid := range []int{30, 30} {
+		proc := ProcState{Pid: opt.IntWith(pid), Ppid: opt.IntWith(parents[pid])}
+		matched, known := filter.match(&filterProcess{state: &proc, ppids: ppids}, false)
+		assert.True(t, known)
+		assert.True(t, matched)
+	}
+	// 20 is looked up once, and then cached
+	assert.Equal(t, 1, lookups)
+
+	proc := ProcState{Pid: opt.IntWith(10), Ppid: opt.IntWith(1)}
+	matched, _ := filter.match(&filterProcess{state: &proc, ppids: ppids}, false)
+	assert.False(t, matched)
+
+	// without a parent PID, ancestry is unknown until the process is filled out
+	proc = ProcState{Pid: opt.IntWith(30)}
+	_, known := filter.match(&filterProcess{state: &proc, ppids: ppids}, false)
+	assert.False(t, known)
+}
@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"sort"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
+)
+
+// groupProcesses aggregates processes into one summary per group, sorted by the group key.
+// Processes that have no value for the key, such as an unknown username, are grouped together under an empty key.
+func groupProcesses(procs []ProcState, by GroupBy) []ProcState {
+	groups := map[string]*ProcState{}
+	keys := []string{}
+	for _, proc := range procs {
+		key := groupKey(proc, by)
+		group, ok := groups[key]
+		if !ok {
+			group = &ProcState{Group: ProcGroupInfo{By: by, Key: key}}
+			switch by {
+			case GroupByName:
+				group.Name = key
+			case GroupByExe:
+				group.Exe = key
+			case GroupByUsername:
+				group.Username = key
+			}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		addToGroup(group, proc)
+	}
+
+	sort.Strings(keys)
+	result := make([]ProcState, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *groups[key])
+	}
+	return result
+}
+
+// groupKey returns the value that a process is grouped by
+func groupKey(proc ProcState, by GroupBy) string {
+	switch by {
+	case GroupByName:
+		return proc.Name
+	case GroupByExe:
+		return proc.Exe
+	case GroupByUsername:
+		return proc.Username
+	case GroupByCgroup:
+		switch stats := proc.Cgroup.(type) {
+		case *cgroup.StatsV1:
+			return stats.ID
+		case *cgroup.StatsV2:
+			return stats.ID
+		}
+	}
+	return ""
+}
+
+// addToGroup adds the metrics of a process to the summary of its group
+func addToGroup(group *ProcState, proc ProcState) {
+	group.Group.Count = opt.IntWith(group.Group.Count.ValueOr(0) + 1)
+
+	group.CPU.Total.Pct = addFloat(group.CPU.Total.Pct, proc.CPU.Total.Pct)
+	group.CPU.Total.Norm.Pct = addFloat(group.CPU.Total.Norm.Pct, proc.CPU.Total.Norm.Pct)
+	group.CPU.Total.Value = addFloat(group.CPU.Total.Value, proc.CPU.Total.Value)
+	group.CPU.Total.Ticks = addUint(group.CPU.Total.Ticks, proc.CPU.Total.Ticks)
+	group.CPU.User.Ticks = addUint(group.CPU.User.Ticks, proc.CPU.User.Ticks)
+	group.CPU.System.Ticks = addUint(group.CPU.System.Ticks, proc.CPU.System.Ticks)
+
+	group.Memory.Rss.Bytes = addUint(group.Memory.Rss.Bytes, proc.Memory.Rss.Bytes)
+	group.Memory.Pss = addUint(group.Memory.Pss, proc.Memory.Pss)
+	group.FD.Open = addUint(group.FD.Open, proc.FD.Open)
+
+	// start times are UTC timestamps in a fixed layout, so they sort as strings
+	if start := proc.CPU.StartTime; start != "" {
+		if group.Group.StartTime.Min == "" || start < group.Group.StartTime.Min {
+			group.Group.StartTime.Min = start
+		}
+		if start > group.Group.StartTime.Max {
+			group.Group.StartTime.Max = start
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
+)
+
+func TestGroupProcesses(t *testing.T) {
+	newProc := func(name, start string, pct float64, rss uint64) ProcState {
+		return ProcState{
+			Name:     name,
+			Username: "www-data",
+			CPU: ProcCPUInfo{
+				StartTime: start,
+				Total:     CPUTotal{Pct: opt.FloatWith(pct), Ticks: opt.UintWith(100)},
+			},
+			Memory: ProcMemInfo{Rss: MemBytePct{Bytes: opt.UintWith(rss)}},
+			FD:     ProcFDInfo{Open: opt.UintWith(5)},
+		}
+	}
+	procs := []ProcState{
+		newProc("nginx", "2023-01-01T12:00:00.000Z", 1, 1000),
+		newProc("php-fpm", "2023-01-01T12:00:00.000Z", 5, 8000),
+		newProc("nginx", "2023-01-01T12:05:00.000Z", 2, 2000),
+		newProc("nginx", "2023-01-01T11:00:00.000Z", 3, 3000),
+	}
+
+	groups := groupProcesses(procs, GroupByName)
+	require.Len(t, groups, 2)
+
+	nginx := groups[0]
+	assert.Equal(t, "nginx", nginx.Name)
+	assert.Equal(t, GroupByName, nginx.Group.By)
+	assert.Equal(t, "nginx", nginx.Group.Key)
+	assert.Equal(t, 3, nginx.Group.Count.ValueOr(0))
+	assert.InDelta(t, 6.0, nginx.CPU.Total.Pct.ValueOr(0), 1e-9)
+	assert.Equal(t, uint64(300), nginx.CPU.Total.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(6000), nginx.Memory.Rss.Bytes.ValueOr(0))
+	assert.Equal(t, uint64(15), nginx.FD.Open.ValueOr(0))
+	assert.False(t, nginx.Memory.Pss.Exists())
+	assert.Equal(t, "2023-01-01T11:00:00.000Z", nginx.Group.StartTime.Min)
+	assert.Equal(t, "2023-01-01T12:05:00.000Z", nginx.Group.StartTime.Max)
+
+	assert.Equal(t, "php-fpm", groups[1].Name)
+	assert.Equal(t, 1, groups[1].Group.Count.ValueOr(0))
+
+	byUser := groupProcesses(procs, GroupByUsername)
+	require.Len(t, byUser, 1)
+	assert.Equal(t, "www-data", byUser[0].Username)
+	assert.Empty(t, byUser[0].Name)
+	assert.Equal(t, 4, byUser[0].Group.Count.ValueOr(0))
+
+	// processes without a cgroup are grouped together
+	procs[0].Cgroup = &cgroup.StatsV2{ID: "nginx.service"}
+	procs[2].Cgroup = &cgroup.StatsV2{ID: "nginx.service"}
+	byCgroup := groupProcesses(procs, GroupByCgroup)
+	require.Len(t, byCgroup, 2)
+	assert.Equal(t, "", byCgroup[0].Group.Key)
+	assert.Equal(t, 2, byCgroup[0].Group.Count.ValueOr(0))
+	assert.Equal(t, "nginx.service", byCgroup[1].Group.Key)
+	assert.Equal(t, 2, byCgroup[1].Group.Count.ValueOr(0))
+}
+
+func TestGroupByInit(t *testing.T) {
+	procStats := Stats{Procs: []string{".*"}, GroupBy: "pid"}
+	assert.Error(t, procStats.Init())
+
+	procStats = Stats{Procs: []string{".*"}, GroupBy: GroupByCgroup}
+	assert.Error(t, procStats.Init(), "grouping by cgroup requires cgroups")
+
+	procStats = Stats{Procs: []string{".*"}, GroupBy: GroupByExe}
+	assert.NoError(t, procStats.Init())
+}
@@ -53,9 +53,15 @@ func GetProcMemPercentage(proc ProcState, totalPhyMem uint64) opt.Float {
 }
 
 // isProcessInSlice looks up proc in the processes slice and returns if
-// found or not
+// found or not. Group summaries have no pid, so they are matched by group key.
 func isProcessInSlice(processes []ProcState, proc *ProcState) bool {
 	for _, p := range processes {
+		if proc.Group.By != "" {
+			if p.Group.By == proc.Group.By && p.Group.Key == proc.Group.Key {
+				return true
+			}
+			continue
+		}
 		if p.Pid == proc.Pid {
 			return true
 		}
@@ -75,26 +81,127 @@ func isProcessInSlice(processes []ProcState, proc *ProcState) bool {
 // available between samples. This could result in incorrect percentages if the
 // wall-clock is adjusted (prior to Go 1.9) or the machine is suspended.
 func GetProcCPUPercentage(s0, s1 ProcState) ProcState {
-	// Skip if we're missing the total ticks
-	if s0.CPU.Total.Ticks.IsZero() || s1.CPU.Total.Ticks.IsZero() {
+	s1.CPU = getCPUPercentages(s0.CPU, s1.CPU, s0.SampleTime, s1.SampleTime)
+	return s1
+}
+
+// GetProcIORates returns s1 with the per-second rates of the I/O counters filled out,
+// using s0 as the previous sample of the same process.
+func GetProcIORates(s0, s1 ProcState) ProcState {
+	seconds := s1.SampleTime.Sub(s0.SampleTime).Seconds()
+	if seconds <= 0 {
 		return s1
 	}
 
-	timeDelta := s1.SampleTime.Sub(s0.SampleTime)
+	prev, cur := s0.IO, s1.IO
+	s1.IO.PerSec = ProcIORates{
+		ReadChar:            counterRate(prev.ReadChar, cur.ReadChar, seconds),
+		WriteChar:           counterRate(prev.WriteChar, cur.WriteChar, seconds),
+		ReadSyscalls:        counterRate(prev.ReadSyscalls, cur.ReadSyscalls, seconds),
+		WriteSyscalls:       counterRate(prev.WriteSyscalls, cur.WriteSyscalls, seconds),
+		ReadBytes:           counterRate(prev.ReadBytes, cur.ReadBytes, seconds),
+		WriteBytes:          counterRate(prev.WriteBytes, cur.WriteBytes, seconds),
+		CancelledWriteBytes: counterRate(prev.CancelledWriteBytes, cur.CancelledWriteBytes, seconds),
+	}
+
+	return s1
+}
+
+// GetProcActivityRates fills out the per-second rates of the page fault and context switch counters of s1,
+// using s0 as the previous sample.
+func GetProcActivityRates(s0, s1 ProcState) ProcState {
+	seconds := s1.SampleTime.Sub(s0.SampleTime).Seconds()
+	if seconds <= 0 {
+		return s1
+	}
+
+	s1.PageFaults.PerSec = ProcPageFaultRates{
+		Minor: counterRate(s0.PageFaults.Minor, s1.PageFaults.Minor, seconds),
+		Major: counterRate(s0.PageFaults.Major, s1.PageFaults.Major, seconds),
+	}
+	s1.ContextSwitches.PerSec = ProcContextSwitchRates{
+		Voluntary:    counterRate(s0.ContextSwitches.Voluntary, s1.ContextSwitches.Voluntary, seconds),
+		Nonvoluntary: counterRate(s0.ContextSwitches.Nonvoluntary, s1.ContextSwitches.Nonvoluntary, seconds),
+	}
+
+	return s1
+}
+
+// GetProcSchedDelay fills out the run queue delay of s1 since the previous sample s0,
+// both in nanoseconds and as a fraction of the wall time between the samples.
+func GetProcSchedDelay(s0, s1 ProcState) ProcState {
+	prev, cur := s0.Sched.WaitTimeNs, s1.Sched.WaitTimeNs
+	if prev.IsZero() || cur.IsZero() || cur.ValueOr(0) < prev.ValueOr(0) {
+		return s1
+	}
+	wall := s1.SampleTime.Sub(s0.SampleTime)
+	if wall <= 0 {
+		return s1
+	}
+
+	delay := cur.ValueOr(0) - prev.ValueOr(0)
+	s1.Sched.Delay = ProcSchedDelay{
+		Ns:  opt.UintWith(delay),
+		Pct: opt.FloatWith(metric.Round(float64(delay) / float64(wall.Nanoseconds()))),
+	}
+	return s1
+}
+
+// counterRate returns the per-second rate of a counter between two samples
+func counterRate(prev, cur opt.Uint, seconds float64) opt.Float {
+	// counters can't go backwards unless the process was replaced
+	if prev.IsZero() || cur.IsZero() || cur.ValueOr(0) < prev.ValueOr(0) {
+		return opt.NewFloatNone()
+	}
+	return opt.FloatWith(metric.Round(float64(cur.ValueOr(0)-prev.ValueOr(0)) / seconds))
+}
+
+// getCPUPercentages fills out the total and normalized CPU percentages of c1,
+// using c0 as the previous sample. See GetProcCPUPercentage.
+func getCPUPercentages(c0, c1 ProcCPUInfo, t0, t1 time.Time) ProcCPUInfo {
+	// Skip if we're missing the total ticks
+	if c0.Total.Ticks.IsZero() || c1.Total.Ticks.IsZero() {
+		return c1
+	}
+
+	timeDelta := t1.Sub(t0)
 	timeDeltaDur := timeDelta / time.Millisecond
-	totalCPUDeltaMillis := int64(s1.CPU.Total.Ticks.ValueOr(0) - s0.CPU.Total.Ticks.ValueOr(0))
+	totalCPUDeltaMillis := int64(c1.Total.Ticks.ValueOr(0) - c0.Total.Ticks.ValueOr(0))
 
 	pct := float64(totalCPUDeltaMillis) / float64(timeDeltaDur)
 	// In theory this can only happen if the time delta is 0, which is unlikely but possible.
 	// With all the type conversion and non-integer math, this is probably the safest way to check.
 	if math.IsNaN(pct) {
-		return s1
+		return c1
 	}
 	normalizedPct := pct / float64(numcpu.NumCPU())
 
-	s1.CPU.Total.Norm.Pct = opt.FloatWith(metric.Round(normalizedPct))
-	s1.CPU.Total.Pct = opt.FloatWith(metric.Round(pct))
+	c1.Total.Norm.Pct = opt.FloatWith(metric.Round(normalizedPct))
+	c1.Total.Pct = opt.FloatWith(metric.Round(pct))
 
-	return s1
+	return c1
+}
+
+// fillThreadCPUPercentages calculates the CPU percentages of the threads in cur,
+// using the threads of the previous sample of the same process.
+// Threads are matched by TID and start time, so a recycled TID is not compared against an old thread.
+func fillThreadCPUPercentages(last, cur ProcState) []ThreadState {
+	if len(last.Threads) == 0 {
+		return cur.Threads
+	}
+
+	prev := make(map[int]ThreadState, len(last.Threads))
+	for _, thread := range last.Threads {
+		prev[thread.Tid.ValueOr(0)] = thread
+	}
+
+	for i, thread := range cur.Threads {
+		prevThread, ok := prev[thread.Tid.ValueOr(0)]
+		if !ok || prevThread.CPU.StartTime != thread.CPU.StartTime {
+			continue
+		}
+		cur.Threads[i].CPU = getCPUPercentages(prevThread.CPU, thread.CPU, last.SampleTime, cur.SampleTime)
+	}
 
+	return cur.Threads
 }
@@ -0,0 +1,172 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-libs/transform/typeconv"
+)
+
+// LifecycleEventType is the type of a process lifecycle event
+type LifecycleEventType string
+
+var (
+	// ProcessStarted is reported for a process that appeared since the previous snapshot
+	ProcessStarted LifecycleEventType = "started"
+	// ProcessExited is reported for a process that disappeared since the previous snapshot
+	ProcessExited LifecycleEventType = "exited"
+)
+
+// LifecycleEvent reports a process that started or exited between two snapshots
+type LifecycleEvent struct {
+	Type LifecycleEventType
+	// Process is the last known state of the process
+	Process ProcState
+	// Lifetime is the time between the start of the process and the sample it was last seen in.
+	Lifetime time.Duration
+	// CPUTicks and MemoryRss are the total CPU time and resident memory of the process, as of the last sample
+	CPUTicks  opt.Uint
+	MemoryRss opt.Uint
+}
+
+// LifecycleTracker diffs successive process snapshots, such as the ones returned by FetchPids,
+// to report processes that started or exited in-between.
+// A PID that was reused by a new process is reported as both an exited and a started process.
+type LifecycleTracker struct {
+	last *ProcsTrack
+	// filtered holds the PIDs in last that were dropped by the filter of Stats, these don't produce events
+	filtered    map[int]struct{}
+	events      []LifecycleEvent
+	initialized bool
+	mut         sync.Mutex
+}
+
+// NewLifecycleTracker returns a new LifecycleTracker
+func NewLifecycleTracker() *LifecycleTracker {
+	return &LifecycleTracker{
+		last: NewProcsTrack(),
+	}
+}
+
+// Update stores the given snapshot and returns the lifecycle events since the previous one.
+// The first call only stores the snapshot, as there is nothing to compare it with.
+func (lt *LifecycleTracker) Update(pids ProcsMap) []LifecycleEvent {
+	return lt.update(pids, nil, nil)
+}
+
+// Events returns the lifecycle events from the last call to Update.
+func (lt *LifecycleTracker) Events() []LifecycleEvent {
+	lt.mut.Lock()
+	defer lt.mut.Unlock()
+	return lt.events
+}
+
+// update is Update for snapshots where some processes were dropped by the filter or couldn't be fetched.
+// Filtered processes don't produce events, but they are still part of the snapshot, so a process that stops or starts
+// matching a metric filter isn't reported as exited or started.
+// A failed process keeps its previous state, instead of being reported as exited and then started again once it can be fetched.
+func (lt *LifecycleTracker) update(pids, filtered ProcsMap, failed map[int]struct{}) []LifecycleEvent {
+	lt.mut.Lock()
+	defer lt.mut.Unlock()
+
+	next := make(ProcsMap, len(pids)+len(filtered))
+	nextFiltered := make(map[int]struct{}, len(filtered))
+	for pid, cur := range filtered {
+		next[pid] = cur
+		nextFiltered[pid] = struct{}{}
+	}
+	for pid, cur := range pids {
+		next[pid] = cur
+		delete(nextFiltered, pid)
+	}
+
+	lt.last.mut.RLock()
+	for pid := range failed {
+		if _, ok := pids[pid]; ok {
+			continue
+		}
+		if prev, ok := lt.last.pids[pid]; ok {
+			next[pid] = prev
+			if _, wasFiltered := lt.filtered[pid]; wasFiltered {
+				nextFiltered[pid] = struct{}{}
+			} else {
+				delete(nextFiltered, pid)
+			}
+		}
+	}
+
+	var events []LifecycleEvent
+	if lt.initialized {
+		for pid, prev := range lt.last.pids {
+			if _, wasFiltered := lt.filtered[pid]; wasFiltered {
+				continue
+			}
+			if cur, ok := next[pid]; !ok || !isSameProcess(prev, cur) {
+				events = append(events, newLifecycleEvent(ProcessExited, prev))
+			}
+		}
+		for pid, cur := range next {
+			if _, isFiltered := nextFiltered[pid]; isFiltered {
+				continue
+			}
+			if prev, ok := lt.last.pids[pid]; !ok || !isSameProcess(prev, cur) {
+				events = append(events, newLifecycleEvent(ProcessStarted, cur))
+			}
+		}
+	}
+	lt.last.mut.RUnlock()
+
+	lt.initialized = true
+	lt.last.SetMap(next)
+	lt.filtered = nextFiltered
+
+	sort.Slice(events, func(i, j int) bool {
+		iPid, jPid := events[i].Process.Pid.ValueOr(0), events[j].Process.Pid.ValueOr(0)
+		if iPid != jPid {
+			return iPid < jPid
+		}
+		// a reused PID exited before it was started again
+		return events[i].Type == ProcessExited
+	})
+
+	lt.events = events
+	return events
+}
+
+func newLifecycleEvent(eventType LifecycleEventType, proc ProcState) LifecycleEvent {
+	event := LifecycleEvent{
+		Type:      eventType,
+		Process:   proc,
+		CPUTicks:  proc.CPU.Total.Ticks,
+		MemoryRss: proc.Memory.Rss.Bytes,
+	}
+
+	startTime, err := time.Parse(typeconv.TSLayout, proc.CPU.StartTime)
+	if err == nil && !proc.SampleTime.IsZero() && proc.SampleTime.After(startTime) {
+		event.Lifetime = proc.SampleTime.Sub(startTime)
+	}
+
+	return event
+}
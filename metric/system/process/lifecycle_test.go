@@ -0,0 +1,131 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-libs/transform/typeconv"
+)
+
+func TestLifecycleTracker(t *testing.T) {
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	newProc := func(pid int, started time.Time, sampled time.Time) ProcState {
+		return ProcState{
+			Pid:        opt.IntWith(pid),
+			CPU:        ProcCPUInfo{StartTime: typeconv.Time(started).String(), Total: CPUTotal{Ticks: opt.UintWith(500)}},
+			Memory:     ProcMemInfo{Rss: MemBytePct{Bytes: opt.UintWith(4096)}},
+			SampleTime: sampled,
+		}
+	}
+
+	tracker := NewLifecycleTracker()
+	first := start.Add(time.Minute)
+	events := tracker.Update(ProcsMap{
+		1: newProc(1, start, first),
+		2: newProc(2, start, first),
+		3: newProc(3, start, first),
+	})
+	assert.Empty(t, events, "first snapshot should not report events")
+
+	second := first.Add(10 * time.Second)
+	events = tracker.Update(ProcsMap{
+		1: newProc(1, start, second),
+		// PID 3 exited, PID 2 was reused by a new process, PID 4 is new
+		2: newProc(2, first.Add(5*time.Second), second),
+		4: newProc(4, first.Add(time.Second), second),
+	})
+	require.Len(t, events, 4)
+
+	assert.Equal(t, ProcessExited, events[0].Type)
+	assert.Equal(t, 2, events[0].Process.Pid.ValueOr(0))
+	assert.Equal(t, time.Minute, events[0].Lifetime)
+	assert.Equal(t, uint64(500), events[0].CPUTicks.ValueOr(0))
+	assert.Equal(t, uint64(4096), events[0].MemoryRss.ValueOr(0))
+
+	assert.Equal(t, ProcessStarted, events[1].Type)
+	assert.Equal(t, 2, events[1].Process.Pid.ValueOr(0))
+	assert.Equal(t, 5*time.Second, events[1].Lifetime)
+
+	assert.Equal(t, ProcessExited, events[2].Type)
+	assert.Equal(t, 3, events[2].Process.Pid.ValueOr(0))
+
+	assert.Equal(t, ProcessStarted, events[3].Type)
+	assert.Equal(t, 4, events[3].Process.Pid.ValueOr(0))
+	assert.Equal(t, 9*time.Second, events[3].Lifetime)
+}
+
+func TestLifecycleTrackerFailedPids(t *testing.T) {
+	newProc := func(pid int) ProcState {
+		return ProcState{Pid: opt.IntWith(pid), CPU: ProcCPUInfo{StartTime: "2023-01-01T12:00:00.000Z"}}
+	}
+
+	tracker := NewLifecycleTracker()
+	tracker.Update(ProcsMap{1: newProc(1), 2: newProc(2)})
+
+	// PID 2 couldn't be fetched this time, but it still exists
+	events := tracker.update(ProcsMap{1: newProc(1)}, nil, map[int]struct{}{2: {}})
+	assert.Empty(t, events)
+	assert.Empty(t, tracker.Events())
+
+	events = tracker.Update(ProcsMap{1: newProc(1), 2: newProc(2)})
+	assert.Empty(t, events, "a process that was fetched again should not be reported as started")
+
+	events = tracker.Update(ProcsMap{1: newProc(1)})
+	require.Len(t, events, 1)
+	assert.Equal(t, ProcessExited, events[0].Type)
+	assert.Equal(t, 2, events[0].Process.Pid.ValueOr(0))
+	assert.Equal(t, events, tracker.Events())
+}
+
+func TestLifecycleTrackerFilteredPids(t *testing.T) {
+	newProc := func(pid int, startTime string) ProcState {
+		return ProcState{Pid: opt.IntWith(pid), CPU: ProcCPUInfo{StartTime: startTime}}
+	}
+	const start = "2023-01-01T12:00:00.000Z"
+
+	tracker := NewLifecycleTracker()
+	tracker.Update(ProcsMap{1: newProc(1, start)})
+
+	events := tracker.update(ProcsMap{1: newProc(1, start)}, ProcsMap{2: newProc(2, start)}, nil)
+	assert.Empty(t, events, "filtered processes should not produce events")
+
+	// PID 2 crosses a metric filter threshold, and back
+	events = tracker.update(ProcsMap{1: newProc(1, start), 2: newProc(2, start)}, nil, nil)
+	assert.Empty(t, events, "a process that starts matching the filter should not be reported as started")
+	events = tracker.update(ProcsMap{1: newProc(1, start)}, ProcsMap{2: newProc(2, start)}, nil)
+	assert.Empty(t, events, "a process that stops matching the filter should not be reported as exited")
+
+	// PID 2 is reused by a process that matches the filter
+	events = tracker.update(ProcsMap{1: newProc(1, start), 2: newProc(2, "2023-01-01T13:00:00.000Z")}, nil, nil)
+	require.Len(t, events, 1)
+	assert.Equal(t, ProcessStarted, events[0].Type)
+	assert.Equal(t, 2, events[0].Process.Pid.ValueOr(0))
+
+	events = tracker.update(ProcsMap{1: newProc(1, start)}, nil, nil)
+	require.Len(t, events, 1)
+	assert.Equal(t, ProcessExited, events[0].Type)
+}
@@ -0,0 +1,242 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// deletedSuffix is appended to the path of a mapped file that was deleted or replaced on disk
+const deletedSuffix = " (deleted)"
+
+// getMapsSummary summarises the memory mappings of a process from /proc/[PID]/smaps.
+// If smaps isn't available, /proc/[PID]/maps is used instead, which has no RSS values.
+func getMapsSummary(hostfs resolve.Resolver, pid int, cfg MapsConfig) (ProcMapsInfo, error) {
+	path := hostfs.Join("proc", strconv.Itoa(pid), "smaps")
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		path = hostfs.Join("proc", strconv.Itoa(pid), "maps")
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return ProcMapsInfo{}, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+
+	mappings, err := parseMappings(data)
+	if err != nil {
+		return ProcMapsInfo{}, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	// kernel threads have no mappings
+	if len(mappings) == 0 {
+		return ProcMapsInfo{}, nil
+	}
+
+	topN := cfg.TopN
+	if topN <= 0 {
+		topN = DefaultMapsTopN
+	}
+	maps := summariseMappings(mappings, topN)
+	// the limit is only reported along with the count, as it's a system-wide setting
+	maps.MaxCount, err = readSysctlInt(hostfs, "vm", "max_map_count")
+	if err == nil && maps.MaxCount.ValueOr(0) > 0 {
+		maps.UsedPct = opt.FloatWith(metric.Round(float64(maps.Count.ValueOr(0)) / float64(maps.MaxCount.ValueOr(0))))
+	}
+	return maps, nil
+}
+
+// parseMappings parses the mappings of a smaps or maps file.
+// The RSS of a mapping is only set if the file is in the smaps format.
+func parseMappings(data []byte) ([]ProcMapping, error) {
+	var mappings []ProcMapping
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		fields := bytes.Fields(line)
+		// smaps lines other than the mapping headers look like `Rss:                 506 kB` or `VmFlags: rd ex mr mw me`
+		if bytes.HasSuffix(fields[0], []byte(":")) {
+			if len(mappings) > 0 && len(fields) == 3 && bytes.Equal(fields[0], []byte("Rss:")) {
+				rss, err := strconv.ParseUint(string(fields[1]), 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing Rss value %s: %w", fields[1], err)
+				}
+				mappings[len(mappings)-1].Rss = opt.UintWith(rss * 1024)
+			}
+			continue
+		}
+
+		mapping, err := parseMappingHeader(string(line))
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// parseMappingHeader parses a line like `7f2d1c021000-7f2d1c1b6000 r-xp 00022000 fd:01 3150 /usr/lib/libc.so.6`.
+// The path is separated by padding, and may contain spaces.
+func parseMappingHeader(line string) (ProcMapping, error) {
+	parts := strings.SplitN(line, " ", 6)
+	if len(parts) < 5 {
+		return ProcMapping{}, fmt.Errorf("%w: malformed mapping '%s'", ErrParse, line)
+	}
+	bounds := strings.SplitN(parts[0], "-", 2)
+	if len(bounds) != 2 {
+		return ProcMapping{}, fmt.Errorf("%w: malformed address range '%s'", ErrParse, parts[0])
+	}
+	start, err := strconv.ParseUint(bounds[0], 16, 64)
+	if err != nil {
+		return ProcMapping{}, fmt.Errorf("error parsing start address %s: %w", bounds[0], err)
+	}
+	end, err := strconv.ParseUint(bounds[1], 16, 64)
+	if err != nil {
+		return ProcMapping{}, fmt.Errorf("error parsing end address %s: %w", bounds[1], err)
+	}
+
+	mapping := ProcMapping{
+		Address: parts[0],
+		Perms:   parts[1],
+		Size:    end - start,
+	}
+	if len(parts) == 6 {
+		mapping.Path = strings.TrimSpace(parts[5])
+	}
+	if strings.HasSuffix(mapping.Path, deletedSuffix) {
+		mapping.Path = strings.TrimSuffix(mapping.Path, deletedSuffix)
+		mapping.Deleted = true
+	}
+	mapping.Kind = mappingKind(mapping.Path)
+	return mapping, nil
+}
+
+// mappingKind returns the kind of a mapping, based on its path
+func mappingKind(path string) string {
+	switch {
+	case path == "":
+		return "anonymous"
+	case path == "[heap]":
+		return "heap"
+	// threads have their own stacks, which were named [stack:TID] before linux 4.5
+	case strings.HasPrefix(path, "[stack"):
+		return "stack"
+	case path == "[vdso]", path == "[vvar]", path == "[vsyscall]":
+		return "vdso"
+	// POSIX and System V shared memory, memfd files, and shared anonymous mappings, which are backed by /dev/zero
+	case strings.HasPrefix(path, "/dev/shm/"), strings.HasPrefix(path, "/SYSV"),
+		strings.HasPrefix(path, "/memfd:"), path == "/dev/zero":
+		return "shmem"
+	// other pseudo-paths, like the [anon:NAME] mappings named with prctl
+	case strings.HasPrefix(path, "["):
+		return "anonymous"
+	}
+	return "file"
+}
+
+// summariseMappings sums up the mappings by kind and by file, and returns the topN largest ones
+func summariseMappings(mappings []ProcMapping, topN int) ProcMapsInfo {
+	maps := ProcMapsInfo{Count: opt.IntWith(len(mappings))}
+	files := map[string]*ProcMapsFile{}
+	deleted := map[string]*ProcMapsFile{}
+	addFile := func(byPath map[string]*ProcMapsFile, mapping ProcMapping) {
+		file, ok := byPath[mapping.Path]
+		if !ok {
+			file = &ProcMapsFile{Path: mapping.Path}
+			byPath[mapping.Path] = file
+		}
+		file.Count++
+		file.Size += mapping.Size
+		if mapping.Rss.Exists() {
+			file.Rss = opt.UintWith(file.Rss.ValueOr(0) + mapping.Rss.ValueOr(0))
+		}
+	}
+
+	for _, mapping := range mappings {
+		var usage *ProcMapsUsage
+		switch mapping.Kind {
+		case "heap":
+			usage = &maps.Heap
+		case "stack":
+			usage = &maps.Stack
+		case "vdso":
+			usage = &maps.Vdso
+		case "shmem":
+			usage = &maps.Shmem
+		case "file":
+			usage = &maps.File
+			addFile(files, mapping)
+		default:
+			usage = &maps.Anonymous
+		}
+		usage.Count = opt.IntWith(usage.Count.ValueOr(0) + 1)
+		usage.Size = opt.UintWith(usage.Size.ValueOr(0) + mapping.Size)
+		if mapping.Rss.Exists() {
+			usage.Rss = opt.UintWith(usage.Rss.ValueOr(0) + mapping.Rss.ValueOr(0))
+		}
+		// shmem files are usually unlinked on purpose, so only regular files are reported as deleted
+		if mapping.Deleted && mapping.Kind == "file" {
+			addFile(deleted, mapping)
+		}
+	}
+
+	maps.Files = sortedMapsFiles(files)
+	maps.Deleted = sortedMapsFiles(deleted)
+
+	largest := make([]ProcMapping, len(mappings))
+	copy(largest, mappings)
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].Size > largest[j].Size
+	})
+	if len(largest) > topN {
+		largest = largest[:topN]
+	}
+	maps.Largest = largest
+	return maps
+}
+
+// sortedMapsFiles returns the files by descending size
+func sortedMapsFiles(byPath map[string]*ProcMapsFile) []ProcMapsFile {
+	if len(byPath) == 0 {
+		return nil
+	}
+	files := make([]ProcMapsFile, 0, len(byPath))
+	for _, file := range byPath {
+		files = append(files, *file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetMapsSummary(t *testing.T) {
+	maps, err := getMapsSummary(resolve.NewTestResolver("./testdata"), 1236, MapsConfig{TopN: 3})
+	require.NoError(t, err)
+
+	assert.Equal(t, 11, maps.Count.ValueOr(0))
+	assert.Equal(t, 65530, maps.MaxCount.ValueOr(0))
+	assert.True(t, maps.UsedPct.Exists())
+
+	assert.Equal(t, ProcMapsUsage{Count: opt.IntWith(1), Size: opt.UintWith(16384 * 1024), Rss: opt.UintWith(12000 * 1024)}, maps.Heap)
+	assert.Equal(t, ProcMapsUsage{Count: opt.IntWith(1), Size: opt.UintWith(132 * 1024), Rss: opt.UintWith(40 * 1024)}, maps.Stack)
+	// the unnamed mapping and the one named with prctl
+	assert.Equal(t, ProcMapsUsage{Count: opt.IntWith(2), Size: opt.UintWith(65540 * 1024), Rss: opt.UintWith(40004 * 1024)}, maps.Anonymous)
+	assert.Equal(t, ProcMapsUsage{Count: opt.IntWith(1), Size: opt.UintWith(1024 * 1024), Rss: opt.UintWith(512 * 1024)}, maps.Shmem)
+	assert.Equal(t, ProcMapsUsage{Count: opt.IntWith(2), Size: opt.UintWith(24 * 1024), Rss: opt.UintWith(4 * 1024)}, maps.Vdso)
+	assert.Equal(t, 4, maps.File.Count.ValueOr(0))
+
+	assert.Equal(t, []ProcMapsFile{
+		{Path: "/var/lib/app/data file.db", Count: 1, Size: 8192 * 1024, Rss: opt.UintWith(100 * 1024)},
+		{Path: "/usr/lib/libc.so.6", Count: 2, Size: 1828 * 1024, Rss: opt.UintWith(916 * 1024)},
+		{Path: "/usr/bin/server", Count: 1, Size: 32 * 1024, Rss: opt.UintWith(32 * 1024)},
+	}, maps.Files)
+	assert.Equal(t, []ProcMapsFile{
+		{Path: "/var/lib/app/data file.db", Count: 1, Size: 8192 * 1024, Rss: opt.UintWith(100 * 1024)},
+	}, maps.Deleted)
+
+	require.Len(t, maps.Largest, 3)
+	assert.Equal(t, ProcMapping{Address: "7f1a00000000-7f1a04000000", Perms: "rw-p", Kind: "anonymous", Size: 65536 * 1024, Rss: opt.UintWith(40000 * 1024)}, maps.Largest[0])
+	assert.Equal(t, "[heap]", maps.Largest[1].Path)
+	assert.True(t, maps.Largest[2].Deleted)
+}
+
+func TestGetMapsSummaryFallback(t *testing.T) {
+	// maps has the same mappings, without the RSS values
+	root := t.TempDir()
+	data, err := os.ReadFile("./testdata/proc/1236/maps")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "proc", "1236"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1236", "maps"), data, 0o644))
+
+	maps, err := getMapsSummary(resolve.NewTestResolver(root), 1236, MapsConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, 11, maps.Count.ValueOr(0))
+	assert.Equal(t, uint64(16384*1024), maps.Heap.Size.ValueOr(0))
+	assert.False(t, maps.Heap.Rss.Exists())
+	assert.Len(t, maps.Largest, 10)
+	// vm.max_map_count isn't available under this root
+	assert.False(t, maps.MaxCount.Exists())
+}
+
+func TestParseMappingHeader(t *testing.T) {
+	mapping, err := parseMappingHeader("7f2d1c021000-7f2d1c1b6000 r-xp 00022000 fd:01 3150                       /usr/lib/libc.so.6")
+	require.NoError(t, err)
+	assert.Equal(t, ProcMapping{Address: "7f2d1c021000-7f2d1c1b6000", Perms: "r-xp", Kind: "file", Path: "/usr/lib/libc.so.6", Size: 0x195000}, mapping)
+
+	mapping, err = parseMappingHeader("7f2d1c021000-7f2d1c022000 rw-s 00000000 00:01 2048                       /memfd:wayland-shm (deleted)")
+	require.NoError(t, err)
+	assert.Equal(t, "shmem", mapping.Kind)
+	assert.True(t, mapping.Deleted)
+
+	_, err = parseMappingHeader("7f2d1c021000 r-xp")
+	assert.ErrorIs(t, err, ErrParse)
+}
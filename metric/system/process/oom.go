@@ -0,0 +1,144 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
+)
+
+const (
+	// oomScoreAdjMin is the oom_score_adj of processes that the OOM killer never kills
+	oomScoreAdjMin = -1000
+	// cgroupV1Unlimited is the smallest cgroup v1 memory limit that means there's no limit,
+	// the kernel reports the largest page-aligned int64 in that case.
+	cgroupV1Unlimited = 1 << 62
+)
+
+// getOOMHeadroom computes the memory left in the memory cgroup of a process before it runs into its limit.
+// ancestorMax is the lowest memory.max of the parent cgroups on cgroup v2, see getV2AncestorMemoryMax, cgroup v1 reports it as the hierarchical limit.
+// The headroom is zero if the cgroup has no memory limit, or its memory stats weren't read.
+func getOOMHeadroom(stats cgroup.CGStats, ancestorMax opt.Uint) ProcOOMHeadroom {
+	var usage, inactive uint64
+	limit := opt.NewUintNone()
+	switch stats := stats.(type) {
+	case *cgroup.StatsV1:
+		if stats.Memory == nil {
+			return ProcOOMHeadroom{}
+		}
+		usage = stats.Memory.Mem.Usage.Bytes
+		inactive = stats.Memory.Stats.InactiveFile.Bytes
+		// the hierarchical limit is lower if a parent cgroup has a lower limit
+		for _, value := range []uint64{stats.Memory.Mem.Limit.Bytes, stats.Memory.Stats.HierarchicalMemoryLimit.Bytes} {
+			if value > 0 && value < cgroupV1Unlimited && (!limit.Exists() || value < limit.ValueOr(0)) {
+				limit = opt.UintWith(value)
+			}
+		}
+	case *cgroup.StatsV2:
+		if stats.Memory == nil {
+			return ProcOOMHeadroom{}
+		}
+		usage = stats.Memory.Mem.Usage.Bytes
+		inactive = stats.Memory.Stats.InactiveFile.Bytes
+		limit = stats.Memory.Mem.Max.Bytes
+		if ancestorMax.Exists() && (!limit.Exists() || ancestorMax.ValueOr(0) < limit.ValueOr(0)) {
+			limit = ancestorMax
+		}
+	}
+	if limit.ValueOr(0) == 0 {
+		return ProcOOMHeadroom{}
+	}
+
+	workingSet := usage
+	if inactive < workingSet {
+		workingSet -= inactive
+	}
+	var headroom uint64
+	if workingSet < limit.ValueOr(0) {
+		headroom = limit.ValueOr(0) - workingSet
+	}
+	return ProcOOMHeadroom{
+		Bytes: opt.UintWith(headroom),
+		Pct:   opt.FloatWith(metric.Round(float64(headroom) / float64(limit.ValueOr(0)))),
+		Limit: limit,
+	}
+}
+
+// getV2AncestorMemoryMax returns the lowest memory.max of the parent cgroups of a process on cgroup v2,
+// as the memory stats only have the limit of its own cgroup. It's none if no parent has a limit, or the cgroup paths can't be read.
+func getV2AncestorMemoryMax(reader *cgroup.Reader, pid int, stats cgroup.CGStats) opt.Uint {
+	if stats, ok := stats.(*cgroup.StatsV2); !ok || stats.Memory == nil {
+		return opt.NewUintNone()
+	}
+	paths, err := reader.ProcessCgroupPaths(pid)
+	if err != nil {
+		return opt.NewUintNone()
+	}
+	memPath, ok := paths.V2["memory"]
+	if !ok || memPath.FullPath == "" {
+		return opt.NewUintNone()
+	}
+	return getAncestorMemoryMax(memPath.FullPath)
+}
+
+// getAncestorMemoryMax walks up from the cgroup at path, and returns the lowest memory.max of its parents.
+// The walk stops at the root cgroup, or the root of the cgroup namespace, as neither has a memory.max file.
+func getAncestorMemoryMax(path string) opt.Uint {
+	limit := opt.NewUintNone()
+	for dir := filepath.Dir(path); dir != path; path, dir = dir, filepath.Dir(dir) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "memory.max"))
+		if err != nil {
+			break
+		}
+		// a parent without a limit has "max"
+		value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err == nil && (!limit.Exists() || value < limit.ValueOr(0)) {
+			limit = opt.UintWith(value)
+		}
+	}
+	return limit
+}
+
+// oomRiskLess returns true if a is more likely to be OOM-killed than b.
+// Processes in the memory cgroups with the least headroom come first, as the OOM killer is invoked for a cgroup when it runs into its limit,
+// followed by the processes without a cgroup memory limit. Processes are then ordered by their OOM score, which the OOM killer picks its victim by.
+// Processes that are never killed come last.
+func oomRiskLess(a, b ProcState) bool {
+	aExempt, bExempt := a.OOM.ScoreAdj.ValueOr(0) == oomScoreAdjMin, b.OOM.ScoreAdj.ValueOr(0) == oomScoreAdjMin
+	if aExempt != bExempt {
+		return bExempt
+	}
+
+	aLimited, bLimited := a.OOM.Headroom.Pct.Exists(), b.OOM.Headroom.Pct.Exists()
+	if aLimited != bLimited {
+		return aLimited
+	}
+	if aPct, bPct := a.OOM.Headroom.Pct.ValueOr(0), b.OOM.Headroom.Pct.ValueOr(0); aPct != bPct {
+		return aPct < bPct
+	}
+	return a.OOM.Score.ValueOr(0) > b.OOM.Score.ValueOr(0)
+}
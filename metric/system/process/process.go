@@ -22,11 +22,13 @@ package process
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -66,6 +68,17 @@ func ListStates(hostfs resolve.Resolver) ([]ProcState, error) {
 	return plist, nil
 }
 
+// Summary counts the processes on the host by state.
+// Like ListStates, it only fetches the basic info for each PID.
+func Summary(hostfs resolve.Resolver) (ProcSummary, error) {
+	procs, err := ListStates(hostfs)
+	if err != nil {
+		return ProcSummary{}, fmt.Errorf("error listing processes: %w", err)
+	}
+
+	return summarizeStates(hostfs, procs)
+}
+
 // GetPIDState returns the state of a given PID
 // It will return ProcNotExist if the process was not found.
 func GetPIDState(hostfs resolve.Resolver, pid int) (PidState, error) {
@@ -107,19 +120,41 @@ func GetPIDState(hostfs resolve.Resolver, pid int) (PidState, error) {
 
 // Get fetches the configured processes and returns a list of formatted events and root ECS fields
 func (procStats *Stats) Get() ([]mapstr.M, []mapstr.M, error) {
+	return procStats.GetWithContext(context.Background())
+}
+
+// GetWithContext is Get, but stops filling out processes once ctx is done.
+// The processes that were filled out until then are still returned, along with a *DeadlineError.
+func (procStats *Stats) GetWithContext(ctx context.Context) ([]mapstr.M, []mapstr.M, error) {
 	//If the user hasn't configured any kind of process glob, return
 	if len(procStats.Procs) == 0 {
 		return nil, nil, nil
 	}
 
 	// actually fetch the PIDs from the OS-specific code
-	pidMap, plist, err := procStats.FetchPids()
-
-	if err != nil {
+	cycle := newFetchCycle(ctx, procStats.lookupPpid)
+	pidMap, plist, err := procStats.fetchPids(cycle)
+	procStats.cycleStats = cycle.stats
+	var deadlineErr *DeadlineError
+	if err != nil && !errors.As(err, &deadlineErr) {
 		return nil, nil, fmt.Errorf("error gathering PIDs: %w", err)
 	}
+	if procStats.lifecycle != nil {
+		procStats.lifecycle.update(pidMap, cycle.filtered, cycle.failed)
+	}
 	// We use this to track processes over time.
-	procStats.ProcsMap.SetMap(pidMap)
+	procStats.ProcsMap.setMaps(pidMap, cycle.filtered)
+
+	if procStats.EnableTree {
+		tree := NewProcessTree(pidMap)
+		for i := range plist {
+			plist[i].Tree, _ = tree.Subtree(plist[i].Pid.ValueOr(0))
+		}
+	}
+
+	if procStats.GroupBy != "" {
+		plist = groupProcesses(plist, procStats.GroupBy)
+	}
 
 	// filter the process list that will be passed down to users
 	plist = procStats.includeTopProcesses(plist)
@@ -159,13 +194,64 @@ func (procStats *Stats) Get() ([]mapstr.M, []mapstr.M, error) {
 		rootEvents = append(rootEvents, rootMap)
 	}
 
+	if deadlineErr != nil {
+		return procs, rootEvents, fmt.Errorf("error gathering PIDs: %w", deadlineErr)
+	}
 	return procs, rootEvents, nil
 }
 
+// FetchPidsWithContext is FetchPids, but stops filling out processes once ctx is done.
+// The processes that were filled out until then are still returned, along with a *DeadlineError.
+func (procStats *Stats) FetchPidsWithContext(ctx context.Context) (ProcsMap, []ProcState, error) {
+	return procStats.fetchPids(newFetchCycle(ctx, procStats.lookupPpid))
+}
+
+// fetchPids runs the OS-specific FetchPids within the given cycle.
+func (procStats *Stats) fetchPids(cycle *fetchCycle) (ProcsMap, []ProcState, error) {
+	procStats.cycle = cycle
+	pidMap, plist, err := procStats.FetchPids()
+	procStats.cycle = nil
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cycle.ctx.Err(); err != nil {
+		return pidMap, plist, &DeadlineError{Skipped: cycle.skipped, Err: err}
+	}
+	return pidMap, plist, nil
+}
+
+// CycleStats returns the number of processes that couldn't be fully filled out in the last call to Get()
+func (procStats *Stats) CycleStats() CycleStats {
+	return procStats.cycleStats
+}
+
+// LifecycleEvents returns the processes that started or exited between the last two calls to Get().
+// This requires TrackLifecycle to be set.
+func (procStats *Stats) LifecycleEvents() []LifecycleEvent {
+	if procStats.lifecycle == nil {
+		return nil
+	}
+	return procStats.lifecycle.Events()
+}
+
+// ProcessTree returns a tree of the processes from the last call to Get(), and any processes fetched with GetOne() since.
+// Only processes that matched Procs and Filter are part of the tree.
+func (procStats *Stats) ProcessTree() *ProcessTree {
+	return NewProcessTree(procStats.ProcsMap.snapshot())
+}
+
 // GetOne fetches process data for a given PID if its name matches the regexes provided from the host.
 func (procStats *Stats) GetOne(pid int) (mapstr.M, error) {
-	pidStat, _, err := procStats.pidFill(pid, false)
+	return procStats.GetOneWithContext(context.Background(), pid)
+}
+
+// GetOneWithContext is GetOne, but returns a *DeadlineError if ctx is done before the process is filled out.
+func (procStats *Stats) GetOneWithContext(ctx context.Context, pid int) (mapstr.M, error) {
+	pidStat, _, err := procStats.fillPidTimeout(ctx, nil, pid, false)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = &DeadlineError{Skipped: 1, Err: ctxErr}
+		}
 		return nil, fmt.Errorf("error fetching PID %d: %w", pid, err)
 	}
 
@@ -187,29 +273,194 @@ func (procStats *Stats) GetSelf() (ProcState, error) {
 	return pidStat, nil
 }
 
+// GetThreads fetches per-thread data for a given PID.
+// GetThreads doesn't store its samples, so CPU percentages are only calculated against the threads of
+// a previous Get() or GetOne() call for the same process, which requires EnableThreads.
+func (procStats *Stats) GetThreads(pid int) ([]ThreadState, error) {
+	threads, err := getThreadData(procStats.Hostfs, pid)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching threads for PID %d: %w", pid, err)
+	}
+
+	// The main thread has the same ID and start time as the process itself
+	var startTime string
+	for _, thread := range threads {
+		if thread.Tid.ValueOr(0) == pid {
+			startTime = thread.CPU.StartTime
+			break
+		}
+	}
+
+	if last, ok := procStats.ProcsMap.GetProcess(ProcState{Pid: opt.IntWith(pid), CPU: ProcCPUInfo{StartTime: startTime}}); ok {
+		threads = fillThreadCPUPercentages(last, ProcState{Threads: threads, SampleTime: time.Now()})
+	}
+
+	return threads, nil
+}
+
 // pidIter wraps a few lines of generic code that all OS-specific FetchPids() functions must call.
 // this also handles the process of adding to the maps/lists in order to limit the code duplication in all the OS implementations
 func (procStats *Stats) pidIter(pid int, procMap ProcsMap, proclist []ProcState) (ProcsMap, []ProcState) {
-	status, saved, err := procStats.pidFill(pid, true)
+	status, saved, err := procStats.fillPidTimeout(procStats.cycle.context(), procStats.cycle, pid, true)
+	return procStats.pidMerge(pid, status, saved, err, procMap, proclist)
+}
+
+// pidMerge adds the result of a pidFill call to the maps/lists, unless it failed or was filtered out.
+func (procStats *Stats) pidMerge(pid int, status ProcState, saved bool, err error, procMap ProcsMap, proclist []ProcState) (ProcsMap, []ProcState) {
+	if err != nil && procStats.cycle != nil && isSkipError(procStats.cycle, err) {
+		// A skipped process keeps its previous sample, so percentages can still be calculated the next time it's filled out.
+		procStats.cycle.failed[pid] = struct{}{}
+		if last, ok := procStats.ProcsMap.GetPid(pid); ok {
+			procStats.cycle.filtered[pid] = last
+		} else if last, ok := procStats.ProcsMap.getFiltered(pid); ok {
+			procStats.cycle.filtered[pid] = last
+		}
+		if errors.Is(err, ErrPidTimeout) {
+			procStats.logger.Warnf("Skipping PID %d: %s", pid, err)
+		} else {
+			procStats.cycle.skipped++
+		}
+		procStats.cycle.stats.Skipped++
+		return procMap, proclist
+	}
 	if err != nil {
 		procStats.logger.Debugf("Error fetching PID info for %d, skipping: %s", pid, err)
+		// A process that's gone is reported as exited, any other error is most likely transient.
+		vanished := errors.Is(err, syscall.ESRCH) || errors.Is(err, ProcNotExist)
+		if procStats.cycle != nil && vanished {
+			procStats.cycle.stats.Vanished++
+		} else if procStats.cycle != nil {
+			procStats.cycle.failed[pid] = struct{}{}
+			procStats.cycle.stats.Skipped++
+		}
 		return procMap, proclist
 	}
 	if !saved {
-		procStats.logger.Debugf("Process name does not match the provided regex; PID=%d; name=%s", pid, status.Name)
+		// Processes that were only dropped after being filled out are still tracked, so metrics like CPU percentages
+		// can be calculated next time, as the process may match a metric filter then.
+		if procStats.cycle != nil && !status.SampleTime.IsZero() {
+			procStats.cycle.filtered[pid] = status
+		}
 		return procMap, proclist
 	}
+	if procStats.cycle != nil && len(status.Degraded) > 0 {
+		procStats.cycle.stats.Degraded++
+	}
 	procMap[pid] = status
 	proclist = append(proclist, status)
 
 	return procMap, proclist
 }
 
+// fillPids runs pidFill for every given PID, and returns the processes that passed the filter in the same order as the input.
+// If Concurrency is greater than 1, the PIDs are filled by a pool of that many workers.
+func (procStats *Stats) fillPids(pids []int) (ProcsMap, []ProcState) {
+	procMap := make(ProcsMap, len(pids))
+	var plist []ProcState
+
+	if procStats.Concurrency <= 1 {
+		for _, pid := range pids {
+			procMap, plist = procStats.pidIter(pid, procMap, plist)
+		}
+		return procMap, plist
+	}
+
+	// Each worker only writes to the index of the PID it's working on,
+	// so the results can be merged in the original order once all workers are done.
+	cycle := procStats.cycle
+	results := make([]fillResult, len(pids))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < procStats.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				status, saved, err := procStats.fillPidTimeout(cycle.context(), cycle, pids[idx], true)
+				results[idx] = fillResult{status: status, saved: saved, err: err}
+			}
+		}()
+	}
+	for idx := range pids {
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+
+	for idx, res := range results {
+		procMap, plist = procStats.pidMerge(pids[idx], res.status, res.saved, res.err, procMap, plist)
+	}
+
+	return procMap, plist
+}
+
+// fillResult is the result of a fillPid call
+type fillResult struct {
+	status ProcState
+	saved  bool
+	err    error
+}
+
+// isSkipError returns true if a process wasn't filled out because the cycle's context was done, or it ran out of its time budget.
+func isSkipError(cycle *fetchCycle, err error) bool {
+	if errors.Is(err, ErrPidTimeout) {
+		return true
+	}
+	ctxErr := cycle.context().Err()
+	return ctxErr != nil && errors.Is(err, ctxErr)
+}
+
+// fillPidTimeout runs fillPid within the PidTimeout budget, and returns the error of ctx without filling out the process if it's done.
+// If the budget runs out, ErrPidTimeout is returned. fillPid can't be interrupted while it's blocked on a read,
+// so it's left running in the background, and its result is dropped. Until it returns, later calls for the same
+// pid return ErrPidTimeout right away, so a hung process doesn't pile up a blocked goroutine in every cycle.
+func (procStats *Stats) fillPidTimeout(ctx context.Context, cycle *fetchCycle, pid int, filter bool) (ProcState, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return ProcState{}, true, err
+	}
+	if procStats.PidTimeout <= 0 {
+		return procStats.fillPid(ctx, cycle, pid, filter)
+	}
+	if !procStats.inFlight.add(pid) {
+		return ProcState{}, true, fmt.Errorf("%w: still filling it out from an earlier call", ErrPidTimeout)
+	}
+
+	pidCtx, cancel := context.WithTimeout(ctx, procStats.PidTimeout)
+	defer cancel()
+	// buffered, so the goroutine can exit if its result is dropped
+	results := make(chan fillResult, 1)
+	go func() {
+		status, saved, err := procStats.fillPid(pidCtx, cycle, pid, filter)
+		procStats.inFlight.remove(pid)
+		results <- fillResult{status: status, saved: saved, err: err}
+	}()
+
+	select {
+	case res := <-results:
+		if res.err != nil && ctx.Err() == nil && pidCtx.Err() != nil {
+			return res.status, res.saved, fmt.Errorf("%w after %s: %s", ErrPidTimeout, procStats.PidTimeout, res.err)
+		}
+		return res.status, res.saved, res.err
+	case <-pidCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return ProcState{}, true, err
+		}
+		return ProcState{}, true, fmt.Errorf("%w after %s", ErrPidTimeout, procStats.PidTimeout)
+	}
+}
+
 // pidFill is an entrypoint used by OS-specific code to fill out a pid.
 // This in turn calls various OS-specific code to fill out the various bits of PID data
 // This is done to minimize the code duplication between different OS implementations
 // The second return value will only be false if an event has been filtered out
 func (procStats *Stats) pidFill(pid int, filter bool) (ProcState, bool, error) {
+	return procStats.fillPid(context.Background(), procStats.cycle, pid, filter)
+}
+
+// fillPid is pidFill for the given cycle, which may be nil. The cycle is passed explicitly,
+// as a process that ran out of its time budget may still be filled out after its cycle is over.
+// ctx is only used to abort the cgroup reads, the caller is responsible for checking it between processes.
+func (procStats *Stats) fillPid(ctx context.Context, cycle *fetchCycle, pid int, filter bool) (ProcState, bool, error) {
 	// Fetch proc state so we can get the name for filtering based on user's filter.
 
 	// OS-specific entrypoint, get basic info so we can at least run matchProcess
@@ -222,11 +473,30 @@ func (procStats *Stats) pidFill(pid int, filter bool) (ProcState, bool, error) {
 	}
 	status = procStats.cacheCmdLine(status)
 
+	if filter {
+		if reason := procStats.excludeProcess(cycle, &status); reason != "" {
+			procStats.logger.Debugf("Process is excluded: %s; PID=%d; name=%s", reason, pid, status.Name)
+			return status, false, nil
+		}
+	}
+
 	// Filter based on user-supplied func
+	var filterProc *filterProcess
+	if filter && procStats.filter != nil {
+		filterProc = procStats.newFilterProcess(cycle, &status)
+	}
 	if filter {
 		if !procStats.matchProcess(status.Name) {
+			procStats.logger.Debugf("Process name does not match the provided regex; PID=%d; name=%s", pid, status.Name)
 			return status, false, nil
 		}
+		// Only filters on data we already have can be applied here, the rest will be checked once the process is filled out.
+		if filterProc != nil {
+			if matched, known := procStats.filter.match(filterProc, false); known && !matched {
+				procStats.logger.Debugf("Process does not match the provided filter; PID=%d; name=%s", pid, status.Name)
+				return status, false, nil
+			}
+		}
 	}
 
 	//If we've passed the filter, continue to fill out the rest of the metrics
@@ -237,18 +507,80 @@ func (procStats *Stats) pidFill(pid int, filter bool) (ProcState, bool, error) {
 	if len(status.Args) > 0 && status.Cmdline == "" {
 		status.Cmdline = strings.Join(status.Args, " ")
 	}
+	// This happens before the process is stored in ProcsMap, so the values reused by cacheCmdLine are redacted as well.
+	if procStats.redactor != nil {
+		status = procStats.redactor.redactProcess(status)
+	}
+
+	if procStats.EnableSmaps {
+		status.Memory, err = getSmapsData(procStats.Hostfs, pid, status.Memory)
+		if gone := degradeField(procStats.Hostfs, pid, &status, "smaps", err); gone != nil {
+			return status, true, fmt.Errorf("getSmapsData: %w", gone)
+		}
+	}
+
+	if procStats.Maps != nil {
+		status.Maps, err = getMapsSummary(procStats.Hostfs, pid, *procStats.Maps)
+		if gone := degradeField(procStats.Hostfs, pid, &status, "maps", err); gone != nil {
+			return status, true, fmt.Errorf("getMapsSummary: %w", gone)
+		}
+	}
+
+	if procStats.EnableThreads {
+		status.Threads, err = getThreadData(procStats.Hostfs, pid)
+		if gone := degradeField(procStats.Hostfs, pid, &status, "threads", err); gone != nil {
+			return status, true, fmt.Errorf("getThreadData: %w", gone)
+		}
+	}
+
+	if procStats.EnableContainer {
+		status.Namespaces, err = getNamespaces(procStats.Hostfs, pid)
+		if gone := degradeField(procStats.Hostfs, pid, &status, "namespaces", err); gone != nil {
+			return status, true, fmt.Errorf("getNamespaces: %w", gone)
+		}
+		status.Container, err = getContainer(procStats.pathCgroups, pid)
+		if gone := degradeField(procStats.Hostfs, pid, &status, "container", err); gone != nil {
+			return status, true, fmt.Errorf("getContainer: %w", gone)
+		}
+	}
+
+	if procStats.exeHasher != nil {
+		status.ExeInfo, err = getExeInfo(procStats.Hostfs, pid, procStats.exeHasher)
+		if gone := degradeField(procStats.Hostfs, pid, &status, "exe_info", err); gone != nil {
+			return status, true, fmt.Errorf("getExeInfo: %w", gone)
+		}
+	}
+
+	if procStats.EnableSockets {
+		var sockets *socketCache
+		if cycle != nil {
+			sockets = cycle.sockets
+		}
+		status.Sockets, err = getSockets(procStats.Hostfs, pid, sockets, procStats.SocketRemoteEndpoints)
+		if gone := degradeField(procStats.Hostfs, pid, &status, "sockets", err); gone != nil {
+			return status, true, fmt.Errorf("getSockets: %w", gone)
+		}
+	}
 
 	//postprocess with cgroups and percentages
-	last, ok := procStats.ProcsMap.GetPid(status.Pid.ValueOr(0))
+	// A previous sample from a different process that had the same PID would produce bogus percentages, so it's skipped.
+	last, ok := procStats.ProcsMap.GetProcess(status)
 	status.SampleTime = time.Now()
 	if procStats.EnableCgroups {
-		cgStats, err := procStats.cgroups.GetStatsForPid(status.Pid.ValueOr(0))
-		if err != nil {
-			return status, true, fmt.Errorf("cgroups.GetStatsForPid: %w", err)
+		cgStats, err := procStats.cgroups.GetStatsForPidWithContext(ctx, status.Pid.ValueOr(0))
+		// a process that's out of time is skipped, not reported without its cgroup
+		if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+			return status, true, fmt.Errorf("cgroups.GetStatsForPidWithContext: %w", err)
 		}
-		status.Cgroup = cgStats
-		if ok {
-			status.Cgroup.FillPercentages(last.Cgroup, status.SampleTime, last.SampleTime)
+		if gone := degradeField(procStats.Hostfs, pid, &status, "cgroup", err); gone != nil {
+			return status, true, fmt.Errorf("cgroups.GetStatsForPidWithContext: %w", gone)
+		}
+		if err == nil {
+			status.Cgroup = cgStats
+			if ok {
+				status.Cgroup.FillPercentages(last.Cgroup, status.SampleTime, last.SampleTime)
+			}
+			status.OOM.Headroom = getOOMHeadroom(status.Cgroup, getV2AncestorMemoryMax(procStats.cgroups, pid, status.Cgroup))
 		}
 	} // end cgroups processor
 
@@ -274,14 +606,69 @@ func (procStats *Stats) pidFill(pid int, filter bool) (ProcState, bool, error) {
 	}
 	if ok {
 		status = GetProcCPUPercentage(last, status)
+		status = GetProcIORates(last, status)
+		status = GetProcActivityRates(last, status)
+		status = GetProcSchedDelay(last, status)
+		status.Threads = fillThreadCPUPercentages(last, status)
+	}
+
+	if filterProc != nil {
+		if matched, _ := procStats.filter.match(filterProc, true); !matched {
+			procStats.logger.Debugf("Process does not match the provided filter; PID=%d; name=%s", pid, status.Name)
+			return status, false, nil
+		}
 	}
 
 	return status, true, nil
 }
 
-// cacheCmdLine fills out Env and arg metrics from any stored previous metrics for the pid
+// degradeField records a field of a process that couldn't be filled out in state.Degraded, so the process is still reported with the rest of its data.
+// If the process is gone, nothing is recorded and a *FieldError is returned instead, as the process should be dropped.
+func degradeField(hostfs resolve.Resolver, pid int, state *ProcState, field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	fieldErr := newFieldError(field, err)
+	// A file can be missing because the whole process is gone
+	if errors.Is(fieldErr, ErrUnsupported) && errors.Is(err, os.ErrNotExist) {
+		if _, infoErr := GetInfoForPid(hostfs, pid); errors.Is(infoErr, syscall.ESRCH) {
+			fieldErr.Kind = ProcNotExist
+		}
+	}
+	if errors.Is(fieldErr, ProcNotExist) {
+		return fieldErr
+	}
+	state.Degraded = append(state.Degraded, ProcDegradedField{Field: field, Reason: fieldErr.reason()})
+	return nil
+}
+
+// newFilterProcess wraps a process for the filter, and records its parent PID for ancestor lookups in the current cycle.
+func (procStats *Stats) newFilterProcess(cycle *fetchCycle, status *ProcState) *filterProcess {
+	proc := &filterProcess{state: status, cgroups: procStats.pathCgroups}
+	if cycle != nil {
+		proc.ppids = cycle.ppids
+		if status.Ppid.Exists() {
+			proc.ppids.set(status.Pid.ValueOr(0), status.Ppid.ValueOr(0))
+		}
+	} else {
+		proc.ppids = newPpidCache(procStats.lookupPpid)
+	}
+	return proc
+}
+
+// lookupPpid fetches the parent PID of a process that hasn't been seen in the current cycle.
+func (procStats *Stats) lookupPpid(pid int) (int, bool) {
+	info, err := GetInfoForPid(procStats.Hostfs, pid)
+	if err != nil || !info.Ppid.Exists() {
+		return 0, false
+	}
+	return info.Ppid.ValueOr(0), true
+}
+
+// cacheCmdLine fills out Env and arg metrics from any stored previous metrics for the pid.
+// Cached values are only used if the previous metrics are from the same process, and not an earlier owner of the PID.
 func (procStats *Stats) cacheCmdLine(in ProcState) ProcState {
-	if previousProc, ok := procStats.ProcsMap.GetPid(in.Pid.ValueOr(0)); ok {
+	if previousProc, ok := procStats.ProcsMap.GetProcess(in); ok {
 		if procStats.CacheCmdLine {
 			in.Args = previousProc.Args
 			in.Cmdline = previousProc.Cmdline
@@ -300,6 +687,18 @@ func (procStats *Stats) getProcessEvent(process *ProcState) (mapstr.M, error) {
 		process.CPU.User.Ticks = opt.NewUintNone()
 		process.CPU.System.Ticks = opt.NewUintNone()
 		process.CPU.Total.Ticks = opt.NewUintNone()
+
+		// The thread slice is shared with the copy stored in ProcsMap, don't modify it in place
+		if len(process.Threads) > 0 {
+			threads := make([]ThreadState, len(process.Threads))
+			copy(threads, process.Threads)
+			for i := range threads {
+				threads[i].CPU.User.Ticks = opt.NewUintNone()
+				threads[i].CPU.System.Ticks = opt.NewUintNone()
+				threads[i].CPU.Total.Ticks = opt.NewUintNone()
+			}
+			process.Threads = threads
+		}
 	}
 
 	proc := mapstr.M{}
@@ -312,6 +711,30 @@ func (procStats *Stats) getProcessEvent(process *ProcState) (mapstr.M, error) {
 	return proc, err
 }
 
+// excludeProcess returns the reason why a process is excluded by ExcludeKernelThreads, ExcludeSelf or ExcludeUIDs,
+// or an empty string if it isn't. These only need the basic info from GetInfoForPid, so they are checked before anything else is read.
+func (procStats *Stats) excludeProcess(cycle *fetchCycle, status *ProcState) string {
+	if procStats.ExcludeKernelThreads && status.IsKernelThread() {
+		return "kernel thread"
+	}
+	if procStats.ExcludeSelf {
+		if status.Pid.ValueOr(0) == procStats.selfPid || procStats.newFilterProcess(cycle, status).hasAncestor(procStats.selfPid) {
+			return "collector process tree"
+		}
+	}
+	if len(procStats.excludeUIDs) > 0 {
+		uid, err := getProcUID(procStats.Hostfs, status.Pid.ValueOr(0))
+		if err != nil {
+			procStats.logger.Debugf("Error fetching UID of PID %d, not excluding it: %s", status.Pid.ValueOr(0), err)
+			return ""
+		}
+		if _, ok := procStats.excludeUIDs[uid]; ok {
+			return "excluded UID"
+		}
+	}
+	return ""
+}
+
 // matchProcess checks if the provided process name matches any of the process regexes
 func (procStats *Stats) matchProcess(name string) bool {
 	for _, reg := range procStats.procRegexps {
@@ -322,41 +745,58 @@ func (procStats *Stats) matchProcess(name string) bool {
 	return false
 }
 
-// includeTopProcesses filters down the metrics based on top CPU or top Memory settings
+// includeTopProcesses filters down the metrics based on top CPU, Memory, I/O, PSS or OOM risk settings
 func (procStats *Stats) includeTopProcesses(processes []ProcState) []ProcState {
 	if !procStats.IncludeTop.Enabled ||
-		(procStats.IncludeTop.ByCPU == 0 && procStats.IncludeTop.ByMemory == 0) {
+		(procStats.IncludeTop.ByCPU == 0 && procStats.IncludeTop.ByMemory == 0 &&
+			procStats.IncludeTop.ByIO == 0 && procStats.IncludeTop.ByPSS == 0 && procStats.IncludeTop.ByOOMRisk == 0) {
 
 		return processes
 	}
 
 	var result []ProcState
-	if procStats.IncludeTop.ByCPU > 0 {
-		numProcs := procStats.IncludeTop.ByCPU
-		if len(processes) < procStats.IncludeTop.ByCPU {
-			numProcs = len(processes)
-		}
+	result = appendTopProcesses(result, processes, procStats.IncludeTop.ByCPU, func(proc ProcState) float64 {
+		return proc.CPU.Total.Pct.ValueOr(0)
+	})
+	result = appendTopProcesses(result, processes, procStats.IncludeTop.ByMemory, func(proc ProcState) float64 {
+		return float64(proc.Memory.Rss.Bytes.ValueOr(0))
+	})
+	result = appendTopProcesses(result, processes, procStats.IncludeTop.ByIO, func(proc ProcState) float64 {
+		return proc.IO.PerSec.ReadBytes.ValueOr(0) + proc.IO.PerSec.WriteBytes.ValueOr(0)
+	})
+	result = appendTopProcesses(result, processes, procStats.IncludeTop.ByPSS, func(proc ProcState) float64 {
+		return float64(proc.Memory.Pss.ValueOr(0))
+	})
+	result = appendTopProcessesFunc(result, processes, procStats.IncludeTop.ByOOMRisk, oomRiskLess)
 
-		sort.Slice(processes, func(i, j int) bool {
-			return processes[i].CPU.Total.Pct.ValueOr(0) > processes[j].CPU.Total.Pct.ValueOr(0)
-		})
-		result = append(result, processes[:numProcs]...)
-	}
+	return result
+}
 
-	if procStats.IncludeTop.ByMemory > 0 {
-		numProcs := procStats.IncludeTop.ByMemory
-		if len(processes) < procStats.IncludeTop.ByMemory {
-			numProcs = len(processes)
-		}
+// appendTopProcesses sorts the processes by the value returned by the given function,
+// and appends the top n to result, skipping processes that are already in result.
+func appendTopProcesses(result, processes []ProcState, n int, value func(ProcState) float64) []ProcState {
+	return appendTopProcessesFunc(result, processes, n, func(a, b ProcState) bool {
+		return value(a) > value(b)
+	})
+}
 
-		sort.Slice(processes, func(i, j int) bool {
-			return processes[i].Memory.Rss.Bytes.ValueOr(0) > processes[j].Memory.Rss.Bytes.ValueOr(0)
-		})
-		for _, proc := range processes[:numProcs] {
-			proc := proc
-			if !isProcessInSlice(result, &proc) {
-				result = append(result, proc)
-			}
+// appendTopProcessesFunc sorts the processes with the given less function,
+// and appends the first n to result, skipping processes that are already in result.
+func appendTopProcessesFunc(result, processes []ProcState, n int, less func(a, b ProcState) bool) []ProcState {
+	if n <= 0 {
+		return result
+	}
+	if len(processes) < n {
+		n = len(processes)
+	}
+
+	sort.Slice(processes, func(i, j int) bool {
+		return less(processes[i], processes[j])
+	})
+	for _, proc := range processes[:n] {
+		proc := proc
+		if !isProcessInSlice(result, &proc) {
+			result = append(result, proc)
 		}
 	}
 
@@ -365,7 +805,7 @@ func (procStats *Stats) includeTopProcesses(processes []ProcState) []ProcState {
 
 // isWhitelistedEnvVar returns true if the given variable name is a match for
 // the whitelist. If the whitelist is empty it returns false.
-func (procStats Stats) isWhitelistedEnvVar(varName string) bool {
+func (procStats *Stats) isWhitelistedEnvVar(varName string) bool {
 	if len(procStats.envRegexps) == 0 {
 		return false
 	}
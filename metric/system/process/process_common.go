@@ -21,9 +21,15 @@
 package process
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"runtime"
+	"strconv"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/match"
@@ -37,18 +43,128 @@ import (
 // ProcNotExist indicates that a process was not found.
 var ProcNotExist = errors.New("process does not exist")
 
+// The kinds of errors that can occur while filling out a process, besides ProcNotExist for processes that exited in the meantime.
+// The errors returned for a process match one of them with errors.Is, if they are of any of these kinds, see FieldError.
+var (
+	// ErrPermissionDenied indicates that process data couldn't be read due to missing permissions.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrParse indicates that process data was read, but couldn't be parsed.
+	ErrParse = errors.New("parse error")
+	// ErrUnsupported indicates that process data isn't available on this platform or kernel, or for this process.
+	ErrUnsupported = errors.New("unsupported")
+)
+
+// FieldError is an error filling out one field of a process.
+type FieldError struct {
+	Field string
+	// Kind is one of ProcNotExist, ErrPermissionDenied, ErrParse or ErrUnsupported, or nil for any other error.
+	Kind error
+	Err  error
+}
+
+func newFieldError(field string, err error) *FieldError {
+	return &FieldError{Field: field, Kind: errorKind(err), Err: err}
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("error getting %s: %s", e.Field, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if target is the kind of the error
+func (e *FieldError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// reason returns the kind of the error, as reported in ProcDegradedField
+func (e *FieldError) reason() string {
+	switch e.Kind {
+	case ErrPermissionDenied:
+		return "permission_denied"
+	case ErrParse:
+		return "parse_error"
+	case ErrUnsupported:
+		return "unsupported"
+	}
+	return "error"
+}
+
+// errorKind returns the kind of an error, see FieldError.Kind
+func errorKind(err error) error {
+	var numErr *strconv.NumError
+	switch {
+	case errors.Is(err, ProcNotExist), errors.Is(err, syscall.ESRCH):
+		return ProcNotExist
+	case errors.Is(err, ErrPermissionDenied), errors.Is(err, os.ErrPermission):
+		return ErrPermissionDenied
+	case errors.Is(err, ErrUnsupported), errors.Is(err, os.ErrNotExist):
+		return ErrUnsupported
+	case errors.Is(err, ErrParse), errors.As(err, &numErr):
+		return ErrParse
+	}
+	return nil
+}
+
+// CycleStats counts the processes that couldn't be fully filled out in a call to Get(), see Stats.CycleStats()
+type CycleStats struct {
+	// Skipped is the number of processes that couldn't be filled out, and weren't reported.
+	// This includes the processes that were skipped because of the context or PidTimeout.
+	Skipped int
+	// Vanished is the number of processes that exited while they were being filled out.
+	Vanished int
+	// Degraded is the number of reported processes that are missing some of their data, see ProcState.Degraded.
+	Degraded int
+}
+
+// ErrPidTimeout indicates that a process took longer than Stats.PidTimeout to fill out, and was skipped.
+var ErrPidTimeout = errors.New("process took too long to fill out")
+
+// DeadlineError is returned along with the processes that were filled out,
+// when the context of a collection call was done before all processes were.
+type DeadlineError struct {
+	// Skipped is the number of processes that were not filled out because of the context.
+	Skipped int
+	Err     error
+}
+
+func (e *DeadlineError) Error() string {
+	return fmt.Sprintf("process collection stopped early, %d processes skipped: %s", e.Skipped, e.Err)
+}
+
+// Unwrap returns the error of the context, so errors.Is can be used with context.Canceled and context.DeadlineExceeded.
+func (e *DeadlineError) Unwrap() error {
+	return e.Err
+}
+
 //ProcsMap is a convinence wrapper for the oft-used ideom of map[int]ProcState
 type ProcsMap map[int]ProcState
 
 // ProcsTrack is a thread-safe wrapper for a process Stat object's internal map of processes.
+// Entries are only valid for the process that owned the PID when they were stored; see GetProcess.
 type ProcsTrack struct {
 	pids ProcsMap
-	mut  sync.RWMutex
+	// setTimes tracks entries that were stored with SetPid, so they can be evicted if they aren't refreshed.
+	// Entries stored with SetMap are replaced by the next SetMap call and don't need this.
+	setTimes map[int]time.Time
+	// filtered holds the last samples of processes that were filled out but then dropped by Stats.Filter,
+	// so percentages can be calculated if they match the filter later. It's replaced along with the main map.
+	filtered ProcsMap
+	ttl      time.Duration
+	mut      sync.RWMutex
 }
 
+// DefaultPidTTL is how long an entry stored with ProcsTrack.SetPid is kept if it isn't refreshed.
+const DefaultPidTTL = 10 * time.Minute
+
 func NewProcsTrack() *ProcsTrack {
 	return &ProcsTrack{
-		pids: make(ProcsMap, 0),
+		pids:     make(ProcsMap, 0),
+		setTimes: make(map[int]time.Time),
+		ttl:      DefaultPidTTL,
 	}
 }
 
@@ -59,17 +175,78 @@ func (pm *ProcsTrack) GetPid(pid int) (ProcState, bool) {
 	return proc, ok
 }
 
+// GetProcess returns the stored entry for the PID of cur, only if it belongs to the same process as cur.
+// An entry from a previous process that owned the same PID is never returned, as its data is unrelated to the current process.
+// Processes are told apart by their start time, which GetInfoForPid only reports on linux and freebsd;
+// on other platforms, entries are matched by PID alone.
+func (pm *ProcsTrack) GetProcess(cur ProcState) (ProcState, bool) {
+	pid := cur.Pid.ValueOr(0)
+	proc, ok := pm.GetPid(pid)
+	if !ok {
+		proc, ok = pm.getFiltered(pid)
+	}
+	if !ok || !isSameProcess(proc, cur) {
+		return ProcState{}, false
+	}
+	return proc, true
+}
+
 func (pm *ProcsTrack) SetPid(pid int, ps ProcState) {
 	pm.mut.Lock()
 	defer pm.mut.Unlock()
 	pm.pids[pid] = ps
+
+	now := time.Now()
+	pm.setTimes[pid] = now
+	for setPid, setTime := range pm.setTimes {
+		if now.Sub(setTime) > pm.ttl {
+			delete(pm.pids, setPid)
+			delete(pm.setTimes, setPid)
+		}
+	}
 }
 
 func (pm *ProcsTrack) SetMap(pids map[int]ProcState) {
+	pm.setMaps(pids, nil)
+}
+
+// snapshot returns a copy of the stored processes
+func (pm *ProcsTrack) snapshot() ProcsMap {
+	pm.mut.RLock()
+	defer pm.mut.RUnlock()
+	procs := make(ProcsMap, len(pm.pids))
+	for pid, proc := range pm.pids {
+		procs[pid] = proc
+	}
+	return procs
+}
+
+func (pm *ProcsTrack) getFiltered(pid int) (ProcState, bool) {
+	pm.mut.RLock()
+	defer pm.mut.RUnlock()
+	proc, ok := pm.filtered[pid]
+	return proc, ok
+}
+
+// setMaps replaces both the map of reported processes, and the map of processes that were dropped by the filter.
+func (pm *ProcsTrack) setMaps(pids, filtered ProcsMap) {
 	pm.mut.Lock()
 	defer pm.mut.Unlock()
 	pm.pids = pids
+	pm.filtered = filtered
+	pm.setTimes = make(map[int]time.Time)
+}
 
+// isSameProcess returns false if the PID of the previous sample was reused by a new process.
+// If either start time is unknown, the samples are assumed to be from the same process.
+func isSameProcess(prev, cur ProcState) bool {
+	if prev.startTicks.Exists() && cur.startTicks.Exists() {
+		return prev.startTicks.ValueOr(0) == cur.startTicks.ValueOr(0)
+	}
+	if prev.CPU.StartTime == "" || cur.CPU.StartTime == "" {
+		return true
+	}
+	return prev.CPU.StartTime == cur.CPU.StartTime
 }
 
 // ProcCallback is a function that FetchPid* methods can call at various points to do OS-agnostic processing
@@ -85,6 +262,39 @@ type CgroupPctStats struct {
 	CPUSystemPctNorm float64
 }
 
+// fetchCycle holds the state shared by all processes that are fetched in a single Get() call.
+type fetchCycle struct {
+	ctx context.Context
+	// skipped is the number of processes that were not filled out because ctx was done.
+	skipped int
+	stats   CycleStats
+	// filtered holds the processes that were filled out, but then dropped by the filter.
+	filtered ProcsMap
+	// failed holds the processes that still exist, but couldn't be filled out.
+	failed map[int]struct{}
+	ppids  *ppidCache
+	// sockets holds the socket tables of every network namespace seen in this cycle.
+	sockets *socketCache
+}
+
+func newFetchCycle(ctx context.Context, lookupPpid func(int) (int, bool)) *fetchCycle {
+	return &fetchCycle{
+		ctx:      ctx,
+		filtered: ProcsMap{},
+		failed:   map[int]struct{}{},
+		ppids:    newPpidCache(lookupPpid),
+		sockets:  newSocketCache(),
+	}
+}
+
+// context returns the context of the cycle, or context.Background() for processes fetched outside of a cycle.
+func (cycle *fetchCycle) context() context.Context {
+	if cycle == nil {
+		return context.Background()
+	}
+	return cycle.ctx
+}
+
 // Stats stores the stats of processes on the host.
 type Stats struct {
 	Hostfs        resolve.Resolver
@@ -97,18 +307,115 @@ type Stats struct {
 	CgroupOpts    cgroup.ReaderOptions
 	EnableCgroups bool
 	EnableNetwork bool
+	// EnableThreads enables the collection of per-thread metrics from /proc/PID/task. Linux only.
+	EnableThreads bool
+	// TrackLifecycle enables the detection of processes that started or exited between calls to Get(), see LifecycleEvents()
+	TrackLifecycle bool
+	// EnableSmaps enables the collection of PSS, USS and swap metrics from /proc/PID/smaps_rollup. Linux only.
+	EnableSmaps bool
+	// EnableContainer adds the namespace IDs of every process and the container it runs in, derived from its cgroup paths. Linux only.
+	EnableContainer bool
+	// EnableSockets adds the listening ports and connection counts of every process,
+	// from the /proc/net socket tables of its network namespace. Linux only.
+	EnableSockets bool
+	// SocketRemoteEndpoints adds the remote endpoints of the connected sockets of every process, this requires EnableSockets.
+	SocketRemoteEndpoints bool
+	// EnableTree adds the resources used by every process and all of its descendants to its event, see ProcessTree()
+	EnableTree bool
+	// GroupBy aggregates the processes reported by Get() into one summary per group, instead of one event per process.
+	// IncludeTop is applied to the groups. Grouping is disabled if this is empty.
+	GroupBy GroupBy
+	// Maps enables a summary of the memory mappings of every process from /proc/PID/smaps,
+	// by kind and by mapped file, with the largest mappings and the number of mappings against vm.max_map_count. Linux only.
+	Maps *MapsConfig
+	// ExeHash enables the hashing of the executable of every process, and adds its file metadata. Linux only.
+	ExeHash *ExeHashConfig
+	// Redact replaces the secrets in environment variables, arguments and command lines. Redaction is disabled if this is nil.
+	Redact *RedactConfig
+	// ExcludeKernelThreads skips kernel threads, such as kthreadd and its kworker children, see ProcState.IsKernelThread(). Linux only.
+	ExcludeKernelThreads bool
+	// ExcludeSelf skips the process of the collector itself, and all of its descendants.
+	ExcludeSelf bool
+	// ExcludeUIDs skips the processes that run with any of these real user IDs. Linux only.
+	ExcludeUIDs []int
+	// Filter is an optional filter expression that processes must match, in addition to the Procs regexes.
+	Filter *FilterConfig
+	// Concurrency is the number of workers used to fill out process data in FetchPids.
+	// Values lower than 2 fill out processes sequentially. Linux only.
+	Concurrency int
+	// PidTTL is how long process data fetched with GetOne() or GetSelf() is kept for calculating percentages,
+	// if it isn't refreshed. Defaults to DefaultPidTTL.
+	PidTTL time.Duration
+	// PidTimeout is the time budget for filling out a single process. A process that takes longer is skipped,
+	// so it can't block the whole cycle. The read it's blocked on keeps running in the background until it returns,
+	// and the process is skipped in later cycles until then.
+	// There is no budget if this is 0.
+	PidTimeout time.Duration
 	// NetworkMetrics is an allowlist of network metrics,
 	// the names of which can be found in /proc/PID/net/snmp and /proc/PID/net/netstat
 	NetworkMetrics []string
 
 	skipExtended bool
+	selfPid      int
+	excludeUIDs  map[int]struct{}
 	procRegexps  []match.Matcher // List of regular expressions used to whitelist processes.
+	filter       processFilter
+	redactor     *redactor
+	cycleStats   CycleStats
+	exeHasher    *exeHasher
+	pathCgroups  *cgroup.Reader  // Reader for cgroup paths, only set if the filter or the container info use them.
 	envRegexps   []match.Matcher // List of regular expressions used to whitelist env vars.
 	cgroups      *cgroup.Reader
+	cycle        *fetchCycle
+	lifecycle    *LifecycleTracker
+	inFlight     *inFlightPids
 	logger       *logp.Logger
 	host         types.Host
 }
 
+// getSelfPid returns the PID of the collector. If the procfs under hostfs is from another PID namespace, such as the host's
+// when running in a container, this is the PID in that namespace, as /proc/self resolves to it.
+func getSelfPid(hostfs resolve.Resolver) int {
+	if link, err := os.Readlink(hostfs.Join("proc", "self")); err == nil {
+		if pid, err := strconv.Atoi(link); err == nil {
+			return pid
+		}
+	}
+	return os.Getpid()
+}
+
+// inFlightPids is the set of processes that are still being filled out in the background,
+// after running out of their PidTimeout budget.
+type inFlightPids struct {
+	mu   sync.Mutex
+	pids map[int]struct{}
+}
+
+// add marks pid as in flight. It returns false if it already is.
+func (f *inFlightPids) add(pid int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.pids[pid]; ok {
+		return false
+	}
+	f.pids[pid] = struct{}{}
+	return true
+}
+
+// remove marks pid as done
+func (f *inFlightPids) remove(pid int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.pids, pid)
+}
+
+// len returns the number of processes in flight
+func (f *inFlightPids) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.pids)
+}
+
 //PidState are the constants for various PID states
 type PidState string
 
@@ -172,7 +479,49 @@ func (procStats *Stats) Init() error {
 		procStats.logger.Warnf("Collecting all network metrics per-process; this will produce a large volume of data.")
 	}
 
+	if procStats.EnableThreads && runtime.GOOS != "linux" {
+		procStats.logger.Warnf("Per-thread metrics are only available on linux, thread collection will be disabled.")
+		procStats.EnableThreads = false
+	}
+	if procStats.EnableSmaps && runtime.GOOS != "linux" {
+		procStats.logger.Warnf("smaps memory metrics are only available on linux, smaps collection will be disabled.")
+		procStats.EnableSmaps = false
+	}
+	if procStats.EnableSockets && runtime.GOOS != "linux" {
+		procStats.logger.Warnf("The socket inventory is only available on linux, socket collection will be disabled.")
+		procStats.EnableSockets = false
+	}
+	if procStats.Maps != nil && runtime.GOOS != "linux" {
+		procStats.logger.Warnf("Memory map summaries are only available on linux, maps collection will be disabled.")
+		procStats.Maps = nil
+	}
+	if procStats.EnableContainer && runtime.GOOS != "linux" {
+		procStats.logger.Warnf("Namespace and container info is only available on linux, container collection will be disabled.")
+		procStats.EnableContainer = false
+	}
+
+	if len(procStats.ExcludeUIDs) > 0 && runtime.GOOS != "linux" {
+		procStats.logger.Warnf("Excluding processes by UID is only available on linux, ExcludeUIDs will be ignored.")
+		procStats.ExcludeUIDs = nil
+	}
+	if len(procStats.ExcludeUIDs) > 0 {
+		procStats.excludeUIDs = make(map[int]struct{}, len(procStats.ExcludeUIDs))
+		for _, uid := range procStats.ExcludeUIDs {
+			procStats.excludeUIDs[uid] = struct{}{}
+		}
+	}
+	if procStats.ExcludeSelf {
+		procStats.selfPid = getSelfPid(procStats.Hostfs)
+	}
+
 	procStats.ProcsMap = NewProcsTrack()
+	procStats.inFlight = &inFlightPids{pids: map[int]struct{}{}}
+	if procStats.PidTTL > 0 {
+		procStats.ProcsMap.ttl = procStats.PidTTL
+	}
+	if procStats.TrackLifecycle {
+		procStats.lifecycle = NewLifecycleTracker()
+	}
 
 	if len(procStats.Procs) == 0 {
 		return nil
@@ -196,6 +545,21 @@ func (procStats *Stats) Init() error {
 		procStats.envRegexps = append(procStats.envRegexps, reg)
 	}
 
+	if procStats.ExeHash != nil {
+		if runtime.GOOS != "linux" {
+			procStats.logger.Warnf("Executable hashing is only available on linux, hashing will be disabled.")
+		} else if procStats.exeHasher, err = newExeHasher(*procStats.ExeHash); err != nil {
+			return fmt.Errorf("invalid executable hash config: %w", err)
+		}
+	}
+
+	if procStats.Redact != nil {
+		procStats.redactor, err = newRedactor(*procStats.Redact)
+		if err != nil {
+			return fmt.Errorf("failed to compile redaction patterns: %w", err)
+		}
+	}
+
 	if procStats.EnableCgroups {
 		cgReader, err := cgroup.NewReaderOptions(procStats.CgroupOpts)
 		if errors.Is(err, cgroup.ErrCgroupsMissing) {
@@ -206,5 +570,32 @@ func (procStats *Stats) Init() error {
 		}
 		procStats.cgroups = cgReader
 	}
+
+	if procStats.Filter != nil {
+		procStats.filter, err = compileFilter(*procStats.Filter)
+		if err != nil {
+			return fmt.Errorf("failed to compile process filter: %w", err)
+		}
+	}
+
+	if procStats.EnableContainer || (procStats.Filter != nil && procStats.Filter.usesCgroups()) {
+		procStats.pathCgroups = procStats.cgroups
+		if procStats.pathCgroups == nil {
+			procStats.pathCgroups, err = cgroup.NewReader(procStats.Hostfs, false)
+			if err != nil {
+				return fmt.Errorf("error initializing cgroup reader for cgroup paths: %w", err)
+			}
+		}
+	}
+
+	switch procStats.GroupBy {
+	case "", GroupByName, GroupByExe, GroupByUsername:
+	case GroupByCgroup:
+		if !procStats.EnableCgroups {
+			return errors.New("grouping processes by cgroup requires cgroup metrics to be enabled")
+		}
+	default:
+		return fmt.Errorf("unknown process grouping '%s'", procStats.GroupBy)
+	}
 	return nil
 }
@@ -135,11 +135,11 @@ func GetInfoForPid(_ resolve.Resolver, pid int) (ProcState, error) {
 }
 
 // FillPidMetrics is the darwin implementation
-func FillPidMetrics(_ resolve.Resolver, pid int, state ProcState, filter func(string) bool) (ProcState, error) {
+func FillPidMetrics(hostfs resolve.Resolver, pid int, state ProcState, filter func(string) bool) (ProcState, error) {
 
 	args, exe, env, err := getProcArgs(pid, filter)
-	if err != nil {
-		return state, fmt.Errorf("error fetching string data from process: %w", err)
+	if gone := degradeField(hostfs, pid, &state, "args", err); gone != nil {
+		return state, fmt.Errorf("error fetching string data from process: %w", gone)
 	}
 
 	state.Args = args
@@ -27,24 +27,29 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/user"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/mapstr"
 	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 )
 
 // Indulging in one non-const global variable for the sake of storing boot time
 // This value obviously won't change while this code is running.
+// It's accessed atomically, as processes can be filled out concurrently.
 var bootTime uint64 = 0
 
 // system tick multiplier, see C.sysconf(C._SC_CLK_TCK)
 const ticks = 100
 
+// pfKthread is the PF_KTHREAD flag in /proc/[PID]/stat, which is set for kernel threads
+const pfKthread = 0x00200000
+
 // FetchPids is the linux implementation of FetchPids
 func (procStats *Stats) FetchPids() (ProcsMap, []ProcState, error) {
 	dir, err := os.Open(procStats.Hostfs.ResolveHostFS("proc"))
@@ -60,11 +65,9 @@ func (procStats *Stats) FetchPids() (ProcsMap, []ProcState, error) {
 		return nil, nil, fmt.Errorf("error reading directory names: %w", err)
 	}
 
-	procMap := make(ProcsMap)
-	var plist []ProcState
-
 	// Iterate over the directory, fetch just enough info so we can filter based on user input.
 	logger := logp.L()
+	pids := make([]int, 0, len(names))
 	for _, name := range names {
 
 		if !dirIsPid(name) {
@@ -76,62 +79,130 @@ func (procStats *Stats) FetchPids() (ProcsMap, []ProcState, error) {
 			logger.Debugf("Error converting PID name %s", name)
 			continue
 		}
-		procMap, plist = procStats.pidIter(pid, procMap, plist)
+		pids = append(pids, pid)
 	}
 
+	procMap, plist := procStats.fillPids(pids)
+
 	return procMap, plist, nil
 }
 
+// FillPidMetrics fills out the metrics of a process that was fetched with GetInfoForPid.
+// Fields that can't be read are recorded in state.Degraded, an error is only returned if the process is gone.
 func FillPidMetrics(hostfs resolve.Resolver, pid int, state ProcState, filter func(string) bool) (ProcState, error) {
 	// Memory Data
 	var err error
 	state.Memory, err = getMemData(hostfs, pid)
-	if err != nil {
-		return state, fmt.Errorf("error getting memory data for pid %d: %w", pid, err)
+	if gone := degradeField(hostfs, pid, &state, "memory", err); gone != nil {
+		return state, fmt.Errorf("error getting memory data for pid %d: %w", pid, gone)
 	}
 
 	// CPU Data
 	state.CPU, err = getCPUTime(hostfs, pid)
-	if err != nil {
-		return state, fmt.Errorf("error getting CPU data for pid %d: %w", pid, err)
+	if gone := degradeField(hostfs, pid, &state, "cpu", err); gone != nil {
+		return state, fmt.Errorf("error getting CPU data for pid %d: %w", pid, gone)
 	}
 
 	// CLI args
 	if len(state.Args) == 0 {
 		state.Args, err = getArgs(hostfs, pid)
-		if err != nil {
-			return state, fmt.Errorf("error getting CLI args for pid %d: %w", pid, err)
+		if gone := degradeField(hostfs, pid, &state, "args", err); gone != nil {
+			return state, fmt.Errorf("error getting CLI args for pid %d: %w", pid, gone)
 		}
+	}
 
+	// Resource limits
+	state.Limits, err = getLimits(hostfs, pid)
+	if gone := degradeField(hostfs, pid, &state, "limits", err); gone != nil {
+		return state, fmt.Errorf("error getting resource limits for pid %d: %w", pid, gone)
 	}
 
 	// FD metrics
-	state.FD, err = getFDStats(hostfs, pid)
-	if err != nil {
-		return state, fmt.Errorf("error getting FD metrics for pid %d: %w", pid, err)
+	state.FD, err = getFDStats(hostfs, pid, state.Limits.Nofile)
+	if gone := degradeField(hostfs, pid, &state, "fd", err); gone != nil {
+		return state, fmt.Errorf("error getting FD metrics for pid %d: %w", pid, gone)
+	}
+
+	// I/O counters
+	state.IO, err = getIOData(hostfs, pid)
+	if gone := degradeField(hostfs, pid, &state, "io", err); gone != nil {
+		return state, fmt.Errorf("error getting I/O data for pid %d: %w", pid, gone)
 	}
 
 	if state.Env == nil {
-		// env vars
+		// env vars are best effort, as they're only readable by the owner of the process, and filtered by the allowlist anyway.
 		state.Env, _ = getEnvData(hostfs, pid, filter)
 	}
 
-	state.Exe, state.Cwd, err = getProcStringData(hostfs, pid)
-	if err != nil && !errors.Is(err, os.ErrPermission) { // ignore permission errors
-		return state, fmt.Errorf("error getting metadata for pid %d: %w", pid, err)
+	// kernel threads don't have an executable
+	if !state.IsKernelThread() {
+		state.Exe, state.Cwd, err = getProcStringData(hostfs, pid)
+		if gone := degradeField(hostfs, pid, &state, "exe", err); gone != nil {
+			return state, fmt.Errorf("error getting metadata for pid %d: %w", pid, gone)
+		}
 	}
 
-	//username
-	state.Username, err = getUser(hostfs, pid)
-	if err != nil {
-		return state, fmt.Errorf("error creating username for pid %d: %w", pid, err)
+	status, err := getProcStatus(hostfs, pid)
+	if gone := degradeField(hostfs, pid, &state, "status", err); gone != nil {
+		return state, fmt.Errorf("error fetching status for pid %d: %w", pid, gone)
+	}
+	if status != nil {
+		//username
+		users := getUserDB(hostfs)
+		state.Username, err = getUserFromStatus(users, status)
+		if gone := degradeField(hostfs, pid, &state, "username", err); gone != nil {
+			return state, fmt.Errorf("error creating username for pid %d: %w", pid, gone)
+		}
+		state.Groupname = getGroupFromStatus(users, status)
+
+		state.ContextSwitches, err = getContextSwitches(status)
+		if gone := degradeField(hostfs, pid, &state, "context_switches", err); gone != nil {
+			return state, fmt.Errorf("error getting context switches for pid %d: %w", pid, gone)
+		}
+		state.Sched.CPUsAllowed = status["Cpus_allowed_list"]
+
+		// security context
+		state.Security, err = getSecurity(hostfs, pid, status)
+		if gone := degradeField(hostfs, pid, &state, "security", err); gone != nil {
+			return state, fmt.Errorf("error getting security context for pid %d: %w", pid, gone)
+		}
+	}
+
+	// OOM killer score
+	state.OOM, err = getOOMScore(hostfs, pid)
+	if gone := degradeField(hostfs, pid, &state, "oom", err); gone != nil {
+		return state, fmt.Errorf("error getting OOM score for pid %d: %w", pid, gone)
+	}
+
+	// terminals that aren't known by their major number are looked up in sysfs, which is left out of the basic stat info
+	if tty := &state.Session.TTY; tty.Name == "" && tty.Major.Exists() {
+		tty.Name = getCharDeviceName(hostfs, tty.Major.ValueOr(0), tty.Minor.ValueOr(0))
+	}
+
+	// audit login identity
+	state.Audit, err = getAudit(hostfs, pid)
+	if gone := degradeField(hostfs, pid, &state, "audit", err); gone != nil {
+		return state, fmt.Errorf("error getting audit login identity for pid %d: %w", pid, gone)
 	}
+
+	// scheduler statistics
+	state.Sched, err = getSchedStat(hostfs, pid, state.Sched)
+	if gone := degradeField(hostfs, pid, &state, "sched", err); gone != nil {
+		return state, fmt.Errorf("error getting scheduler statistics for pid %d: %w", pid, gone)
+	}
+
+	state.Limits = fillLimitUsage(state)
 	return state, nil
 }
 
 // GetInfoForPid fetches the basic hostinfo from /proc/[PID]/stat
 func GetInfoForPid(hostfs resolve.Resolver, pid int) (ProcState, error) {
-	path := hostfs.Join("proc", strconv.Itoa(pid), "stat")
+	return getInfoFromStat(hostfs, hostfs.Join("proc", strconv.Itoa(pid), "stat"), pid)
+}
+
+// getInfoFromStat parses the basic info from a stat file.
+// /proc/[PID]/stat and /proc/[PID]/task/[TID]/stat share the same format, so this is used for both.
+func getInfoFromStat(hostfs resolve.Resolver, path string, pid int) (ProcState, error) {
 	data, err := ioutil.ReadFile(path)
 	// Transform the error into a more sensible error in cases where the directory doesn't exist, i.e the process is gone
 	if err != nil {
@@ -148,29 +219,44 @@ func GetInfoForPid(hostfs resolve.Resolver, pid int) (ProcState, error) {
 	lIdx := bytes.Index(data, []byte("("))
 	rIdx := bytes.LastIndex(data, []byte(")"))
 	if lIdx < 0 || rIdx < 0 || lIdx >= rIdx || rIdx+2 >= len(data) {
-		return state, fmt.Errorf("failed to extract comm for pid %d from '%v': %w", pid, string(data), err)
+		return state, fmt.Errorf("failed to extract comm for pid %d from '%v': %w", pid, string(data), ErrParse)
 	}
 	state.Name = string(data[lIdx+1 : rIdx])
 
 	// Extract the rest of the fields that we are interested in.
 	fields := bytes.Fields(data[rIdx+2:])
 	if len(fields) <= 36 {
-		return state, fmt.Errorf("expected more stat fields for pid %d from '%v': %w", pid, string(data), err)
+		return state, fmt.Errorf("expected more stat fields for pid %d from '%v': %w", pid, string(data), ErrParse)
 	}
 
 	interests := bytes.Join([][]byte{
-		fields[0], // state
-		fields[1], // ppid
-		fields[2], // pgrp
+		fields[0],  // state
+		fields[1],  // ppid
+		fields[2],  // pgrp
+		fields[3],  // session
+		fields[4],  // tty_nr
+		fields[6],  // flags
+		fields[7],  // minflt
+		fields[8],  // cminflt
+		fields[9],  // majflt
+		fields[10], // cmajflt
 	}, []byte(" "))
 
 	var procState string
-	var ppid, pgid int
+	var ppid, pgid, sid, ttyNr int
+	var flags, minflt, cminflt, majflt, cmajflt uint64
 
 	_, err = fmt.Fscan(bytes.NewBuffer(interests),
 		&procState,
 		&ppid,
 		&pgid,
+		&sid,
+		&ttyNr,
+		&flags,
+		&minflt,
+		&cminflt,
+		&majflt,
+		&cmajflt,
 	)
 	if err != nil {
 		return state, fmt.Errorf("failed to parse stat fields for pid %d from '%v': %w", pid, string(data), err)
@@ -179,23 +265,50 @@ func GetInfoForPid(hostfs resolve.Resolver, pid int) (ProcState, error) {
 	state.Ppid = opt.IntWith(ppid)
 	state.Pgid = opt.IntWith(pgid)
 	state.Pid = opt.IntWith(pid)
+	state.kernelThread = flags&pfKthread != 0
+	state.Session = getSession(pid, sid, uint64(uint32(ttyNr)))
+	state.PageFaults = ProcPageFaults{
+		Minor:         opt.UintWith(minflt),
+		Major:         opt.UintWith(majflt),
+		ChildrenMinor: opt.UintWith(cminflt),
+		ChildrenMajor: opt.UintWith(cmajflt),
+	}
+
+	// The start time is needed to tell apart different processes that had the same PID.
+	startTime, err := strconv.ParseUint(string(fields[19]), 10, 64)
+	if err != nil {
+		return state, fmt.Errorf("error parsing start time value %s for pid %d: %w", fields[19], pid, err)
+	}
+	state.startTicks = opt.UintWith(startTime)
+
+	numThreads, err := strconv.Atoi(string(fields[17]))
+	if err != nil {
+		return state, fmt.Errorf("error parsing thread count %s for pid %d: %w", fields[17], pid, err)
+	}
+	state.NumThreads = opt.IntWith(numThreads)
+
+	state.Sched, err = getSchedFromStat(fields)
+	if err != nil {
+		return state, fmt.Errorf("error parsing scheduling fields for pid %d: %w", pid, err)
+	}
+
+	// The formatted start time also needs /proc/stat, which isn't required for basic PID info.
+	if btime, err := getLinuxBootTime(hostfs); err == nil {
+		state.CPU.StartTime = unixTimeMsToTime(startTicksToUnixMs(startTime, btime))
+	}
 
 	return state, nil
 }
 
 func getProcStringData(hostfs resolve.Resolver, pid int) (string, string, error) {
 	exe, err := os.Readlink(hostfs.Join("proc", strconv.Itoa(pid), "exe"))
-	if errors.Is(err, os.ErrPermission) { // pass through permission errors
-		return "", "", err
-	} else if err != nil {
+	if err != nil {
 		return "", "", fmt.Errorf("error fetching exe from pid %d: %w", pid, err)
 	}
 
 	cwd, err := os.Readlink(hostfs.Join("proc", strconv.Itoa(pid), "cwd"))
-	if errors.Is(err, os.ErrPermission) {
-		return "", "", err
-	} else if err != nil {
-		return "", "", fmt.Errorf("error fetching cwd for pid %d: %w", pid, err)
+	if err != nil {
+		return exe, "", fmt.Errorf("error fetching cwd for pid %d: %w", pid, err)
 	}
 
 	return exe, cwd, nil
@@ -213,20 +326,50 @@ func getUser(hostfs resolve.Resolver, pid int) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("error fetching user ID for pid %d: %w", pid, err)
 	}
+	return getUserFromStatus(getUserDB(hostfs), status)
+}
+
+// getUserFromStatus looks up the username for the real UID in a parsed /proc/[PID]/status file
+func getUserFromStatus(users *userDB, status map[string]string) (string, error) {
 	uidValues, ok := status["Uid"]
 	if !ok {
-		return "", fmt.Errorf("field Uid not found in proc status: %w", err)
+		return "", errors.New("field Uid not found in proc status")
 	}
 	uidStrings := strings.Fields(uidValues)
-	var userFinal string
-	user, err := user.LookupId(uidStrings[0])
-	if err == nil {
-		userFinal = user.Username
-	} else {
-		userFinal = uidStrings[0]
+	if len(uidStrings) == 0 {
+		return "", fmt.Errorf("malformed Uid value '%s' in proc status", uidValues)
 	}
+	return users.userName(uidStrings[0]), nil
+}
 
-	return userFinal, nil
+// getGroupFromStatus looks up the group name for the real GID in a parsed /proc/[PID]/status file
+func getGroupFromStatus(users *userDB, status map[string]string) string {
+	gidStrings := strings.Fields(status["Gid"])
+	if len(gidStrings) == 0 {
+		return ""
+	}
+	return users.groupName(gidStrings[0])
+}
+
+// getContextSwitches parses the context switch counters from a parsed /proc/[PID]/status file.
+// The counters are missing on kernels older than 2.6.23.
+func getContextSwitches(status map[string]string) (ProcContextSwitches, error) {
+	switches := ProcContextSwitches{}
+	for key, dst := range map[string]*opt.Uint{
+		"voluntary_ctxt_switches":    &switches.Voluntary,
+		"nonvoluntary_ctxt_switches": &switches.Nonvoluntary,
+	} {
+		value, ok := status[key]
+		if !ok {
+			continue
+		}
+		count, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return switches, fmt.Errorf("error parsing %s value '%s': %w", key, value, err)
+		}
+		*dst = opt.UintWith(count)
+	}
+	return switches, nil
 }
 
 func getEnvData(hostfs resolve.Resolver, pid int, filter func(string) bool) (mapstr.M, error) {
@@ -268,6 +411,9 @@ func getMemData(hostfs resolve.Resolver, pid int) (ProcMemInfo, error) {
 	}
 
 	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return state, fmt.Errorf("%w: expected at least 3 fields in %s, got %d", ErrParse, path, len(fields))
+	}
 
 	size, err := strconv.ParseUint(fields[0], 10, 64)
 	if err != nil {
@@ -287,21 +433,177 @@ func getMemData(hostfs resolve.Resolver, pid int) (ProcMemInfo, error) {
 	return state, nil
 }
 
+// getIOData fetches the I/O counters from /proc/[PID]/io.
+// Reading this file requires ptrace access to the process. Permission errors are returned like any other error,
+// and FillPidMetrics reports them as a degraded io field.
+func getIOData(hostfs resolve.Resolver, pid int) (ProcIOInfo, error) {
+	state := ProcIOInfo{}
+
+	path := hostfs.Join("proc", strconv.Itoa(pid), "io")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return state, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(strings.TrimSpace(fields[1]), 10, 64)
+		if err != nil {
+			return state, fmt.Errorf("error parsing I/O value %s for pid %d: %w", fields[0], pid, err)
+		}
+
+		switch fields[0] {
+		case "rchar":
+			state.ReadChar = opt.UintWith(value)
+		case "wchar":
+			state.WriteChar = opt.UintWith(value)
+		case "syscr":
+			state.ReadSyscalls = opt.UintWith(value)
+		case "syscw":
+			state.WriteSyscalls = opt.UintWith(value)
+		case "read_bytes":
+			state.ReadBytes = opt.UintWith(value)
+		case "write_bytes":
+			state.WriteBytes = opt.UintWith(value)
+		case "cancelled_write_bytes":
+			state.CancelledWriteBytes = opt.UintWith(value)
+		}
+	}
+
+	return state, nil
+}
+
+// schedPolicies maps the policy numbers from /proc/[PID]/stat to the SCHED_* names, see sched(7)
+var schedPolicies = map[uint64]string{
+	0: "other",
+	1: "fifo",
+	2: "rr",
+	3: "batch",
+	5: "idle",
+	6: "deadline",
+}
+
+// getSchedFromStat parses the nice value, priority and scheduling policy from the stat fields that follow the comm value.
+func getSchedFromStat(fields [][]byte) (ProcSchedInfo, error) {
+	sched := ProcSchedInfo{}
+
+	priority, err := strconv.Atoi(string(fields[15]))
+	if err != nil {
+		return sched, fmt.Errorf("error parsing priority %s: %w", fields[15], err)
+	}
+	sched.Priority = opt.IntWith(priority)
+
+	nice, err := strconv.Atoi(string(fields[16]))
+	if err != nil {
+		return sched, fmt.Errorf("error parsing nice value %s: %w", fields[16], err)
+	}
+	sched.Nice = opt.IntWith(nice)
+
+	// the policy was added in linux 2.5.19
+	if len(fields) > 38 {
+		policy, err := strconv.ParseUint(string(fields[38]), 10, 64)
+		if err != nil {
+			return sched, fmt.Errorf("error parsing scheduling policy %s: %w", fields[38], err)
+		}
+		if name, ok := schedPolicies[policy]; ok {
+			sched.Policy = name
+		} else {
+			sched.Policy = strconv.FormatUint(policy, 10)
+		}
+	}
+
+	return sched, nil
+}
+
+// getSchedStat fetches the time spent on a CPU, the time spent waiting on a run queue
+// and the number of timeslices from /proc/[PID]/schedstat.
+// The file is missing when the kernel is built without CONFIG_SCHED_INFO, in which case sched is returned unchanged.
+func getSchedStat(hostfs resolve.Resolver, pid int, sched ProcSchedInfo) (ProcSchedInfo, error) {
+	path := hostfs.Join("proc", strconv.Itoa(pid), "schedstat")
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sched, nil
+	} else if err != nil {
+		return sched, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return sched, fmt.Errorf("expected 3 fields in %s, got '%s'", path, string(data))
+	}
+	values := make([]uint64, 3)
+	for i := range values {
+		values[i], err = strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return sched, fmt.Errorf("error parsing schedstat value %s for pid %d: %w", fields[i], pid, err)
+		}
+	}
+
+	sched.RunTimeNs = opt.UintWith(values[0])
+	sched.WaitTimeNs = opt.UintWith(values[1])
+	sched.Timeslices = opt.UintWith(values[2])
+	return sched, nil
+}
+
+// getOOMScore fetches the OOM killer score and its adjustment from /proc/[PID]/oom_score and /proc/[PID]/oom_score_adj.
+// The files are missing on procfs implementations without an OOM killer, in which case the values are none.
+func getOOMScore(hostfs resolve.Resolver, pid int) (ProcOOMInfo, error) {
+	oom := ProcOOMInfo{}
+	for _, file := range []struct {
+		name string
+		dst  *opt.Int
+	}{
+		{"oom_score", &oom.Score},
+		{"oom_score_adj", &oom.ScoreAdj},
+	} {
+		path := hostfs.Join("proc", strconv.Itoa(pid), file.name)
+		data, err := ioutil.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return oom, fmt.Errorf("error opening file %s: %w", path, err)
+		}
+
+		value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return oom, fmt.Errorf("error parsing %s value '%s' for pid %d: %w", file.name, strings.TrimSpace(string(data)), pid, ErrParse)
+		}
+		*file.dst = opt.IntWith(value)
+	}
+	return oom, nil
+}
+
 func getCPUTime(hostfs resolve.Resolver, pid int) (ProcCPUInfo, error) {
+	return getCPUTimeFromStat(hostfs, hostfs.Join("proc", strconv.Itoa(pid), "stat"), pid)
+}
+
+// getCPUTimeFromStat fetches the CPU times from a /proc/[PID]/stat or /proc/[PID]/task/[TID]/stat file
+func getCPUTimeFromStat(hostfs resolve.Resolver, pathCPU string, pid int) (ProcCPUInfo, error) {
 	state := ProcCPUInfo{}
 
-	pathCPU := hostfs.Join("proc", strconv.Itoa(pid), "stat")
 	data, err := ioutil.ReadFile(pathCPU)
 	if err != nil {
 		return state, fmt.Errorf("error opening file %s: %w", pathCPU, err)
 	}
-	fields := strings.Fields(string(data))
+	// The comm value can contain spaces, so the fields are split after its closing parenthesis, as in getInfoFromStat.
+	rIdx := bytes.LastIndex(data, []byte(")"))
+	if rIdx < 0 {
+		return state, fmt.Errorf("failed to extract comm for pid %d from '%v': %w", pid, string(data), ErrParse)
+	}
+	fields := strings.Fields(string(data[rIdx+1:]))
+	if len(fields) <= 19 {
+		return state, fmt.Errorf("expected more stat fields for pid %d from '%v': %w", pid, string(data), ErrParse)
+	}
 
-	user, err := strconv.ParseUint(fields[13], 10, 64)
+	user, err := strconv.ParseUint(fields[11], 10, 64)
 	if err != nil {
 		return state, fmt.Errorf("error parsing user CPU times for pid %d: %w", pid, err)
 	}
-	sys, err := strconv.ParseUint(fields[14], 10, 64)
+	sys, err := strconv.ParseUint(fields[12], 10, 64)
 	if err != nil {
 		return state, fmt.Errorf("error parsing system CPU times for pid %d: %w", pid, err)
 	}
@@ -317,17 +619,21 @@ func getCPUTime(hostfs resolve.Resolver, pid int) (ProcCPUInfo, error) {
 	state.System.Ticks = opt.UintWith(sys * (1000 / ticks))
 	state.Total.Ticks = opt.UintWith(opt.SumOptUint(state.User.Ticks, state.System.Ticks))
 
-	startTime, err := strconv.ParseUint(fields[21], 10, 64)
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
 	if err != nil {
-		return state, fmt.Errorf("error parsing start time value %s for pid %d: %w", fields[21], pid, err)
+		return state, fmt.Errorf("error parsing start time value %s for pid %d: %w", fields[19], pid, err)
 	}
 
+	state.StartTime = unixTimeMsToTime(startTicksToUnixMs(startTime, btime))
+	return state, nil
+}
+
+// startTicksToUnixMs converts a start time in USER_HZ since boot to milliseconds since Unix epoch
+func startTicksToUnixMs(startTime, btime uint64) uint64 {
 	startTime /= ticks
 	startTime += btime
 	startTime *= 1000
-
-	state.StartTime = unixTimeMsToTime(startTime)
-	return state, nil
+	return startTime
 }
 
 func getArgs(hostfs resolve.Resolver, pid int) ([]string, error) {
@@ -352,41 +658,108 @@ func getArgs(hostfs resolve.Resolver, pid int) ([]string, error) {
 	return args, nil
 }
 
-func getFDStats(hostfs resolve.Resolver, pid int) (ProcFDInfo, error) {
-	state := ProcFDInfo{}
+// rlimitNames maps the rows of /proc/[PID]/limits to the fields of ProcResourceLimits
+var rlimitNames = []struct {
+	name  string
+	field func(*ProcResourceLimits) *ProcRlimit
+}{
+	{"Max cpu time", func(l *ProcResourceLimits) *ProcRlimit { return &l.CPU }},
+	{"Max file size", func(l *ProcResourceLimits) *ProcRlimit { return &l.FileSize }},
+	{"Max data size", func(l *ProcResourceLimits) *ProcRlimit { return &l.Data }},
+	{"Max stack size", func(l *ProcResourceLimits) *ProcRlimit { return &l.Stack }},
+	{"Max core file size", func(l *ProcResourceLimits) *ProcRlimit { return &l.Core }},
+	{"Max resident set", func(l *ProcResourceLimits) *ProcRlimit { return &l.RSS }},
+	{"Max processes", func(l *ProcResourceLimits) *ProcRlimit { return &l.Nproc }},
+	{"Max open files", func(l *ProcResourceLimits) *ProcRlimit { return &l.Nofile }},
+	{"Max locked memory", func(l *ProcResourceLimits) *ProcRlimit { return &l.Memlock }},
+	{"Max address space", func(l *ProcResourceLimits) *ProcRlimit { return &l.AS }},
+	{"Max file locks", func(l *ProcResourceLimits) *ProcRlimit { return &l.Locks }},
+	{"Max pending signals", func(l *ProcResourceLimits) *ProcRlimit { return &l.Sigpending }},
+	{"Max msgqueue size", func(l *ProcResourceLimits) *ProcRlimit { return &l.Msgqueue }},
+	{"Max nice priority", func(l *ProcResourceLimits) *ProcRlimit { return &l.Nice }},
+	{"Max realtime priority", func(l *ProcResourceLimits) *ProcRlimit { return &l.Rtprio }},
+	{"Max realtime timeout", func(l *ProcResourceLimits) *ProcRlimit { return &l.Rttime }},
+}
+
+// getLimits parses all the resource limits from /proc/[PID]/limits.
+// Rows that are unknown to this version are skipped.
+func getLimits(hostfs resolve.Resolver, pid int) (ProcResourceLimits, error) {
+	limits := ProcResourceLimits{}
 
 	path := hostfs.Join("proc", strconv.Itoa(pid), "limits")
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		return state, fmt.Errorf("error opening file %s: %w", path, err)
+		return limits, fmt.Errorf("error opening file %s: %w", path, err)
 	}
 
 	for _, line := range strings.Split(string(data), "\n") {
-		if strings.HasPrefix(line, "Max open files") {
-			fields := strings.Fields(line)
-			if len(fields) == 6 {
-
-				softLimit, err := strconv.ParseUint(fields[3], 10, 64)
-				if err != nil {
-					return state, fmt.Errorf("error parsing limits value %s for pid %d: %w", fields[3], pid, err)
-				}
-				state.Limit.Soft = opt.UintWith(softLimit)
-
-				hardLimit, err := strconv.ParseUint(fields[4], 10, 64)
-				if err != nil {
-					return state, fmt.Errorf("error parsing limits value %s for pid %d: %w", fields[3], pid, err)
-				}
-				state.Limit.Hard = opt.UintWith(hardLimit)
+		for _, row := range rlimitNames {
+			if !strings.HasPrefix(line, row.name) {
+				continue
+			}
+			// the units column is empty for some limits
+			fields := strings.Fields(line[len(row.name):])
+			if len(fields) < 2 {
+				return limits, fmt.Errorf("error parsing limits line '%s' for pid %d", line, pid)
+			}
+
+			limit := row.field(&limits)
+			limit.Soft, limit.SoftUnlimited, err = parseRlimit(fields[0])
+			if err != nil {
+				return limits, fmt.Errorf("error parsing limits value %s for pid %d: %w", fields[0], pid, err)
 			}
+			limit.Hard, limit.HardUnlimited, err = parseRlimit(fields[1])
+			if err != nil {
+				return limits, fmt.Errorf("error parsing limits value %s for pid %d: %w", fields[1], pid, err)
+			}
+			break
+		}
+	}
 
+	return limits, nil
+}
+
+// parseRlimit parses a soft or hard limit value, which is either a number or "unlimited"
+func parseRlimit(value string) (opt.Uint, bool, error) {
+	if value == "unlimited" {
+		return opt.NewUintNone(), true, nil
+	}
+	limit, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return opt.NewUintNone(), false, err
+	}
+	return opt.UintWith(limit), false, nil
+}
+
+// fillLimitUsage returns the limits of the process with the utilisation of the limits that have a known usage:
+// open FDs against nofile, threads against nproc and virtual memory size against as.
+// nproc counts all the tasks of the real user, so the ratio for a single process is a lower bound.
+func fillLimitUsage(state ProcState) ProcResourceLimits {
+	limits := state.Limits
+	usage := func(used opt.Uint, limit *ProcRlimit) {
+		if used.IsZero() || limit.Soft.ValueOr(0) == 0 {
+			return
 		}
+		limit.UsedPct = opt.FloatWith(metric.Round(float64(used.ValueOr(0)) / float64(limit.Soft.ValueOr(0))))
 	}
 
+	usage(state.FD.Open, &limits.Nofile)
+	if state.NumThreads.Exists() {
+		usage(opt.UintWith(uint64(state.NumThreads.ValueOr(0))), &limits.Nproc)
+	}
+	usage(state.Memory.Size, &limits.AS)
+	return limits
+}
+
+// getFDStats counts the open FDs of the process. The limits are taken from the already parsed nofile rlimit.
+func getFDStats(hostfs resolve.Resolver, pid int, nofile ProcRlimit) (ProcFDInfo, error) {
+	state := ProcFDInfo{}
+	state.Limit.Soft = nofile.Soft
+	state.Limit.Hard = nofile.Hard
+
 	pathFD := hostfs.Join("proc", strconv.Itoa(pid), "fd")
 	fds, err := ioutil.ReadDir(pathFD)
-	if errors.Is(err, os.ErrPermission) { //ignore permission errors, passthrough other data
-		return state, nil
-	} else if err != nil {
+	if err != nil {
 		return state, fmt.Errorf("error reading FD directory for pid %d: %w", pid, err)
 	}
 	state.Open = opt.UintWith(uint64(len(fds)))
@@ -395,8 +768,8 @@ func getFDStats(hostfs resolve.Resolver, pid int) (ProcFDInfo, error) {
 
 // getLinuxBootTime fetches the static unix time for when the system was booted.
 func getLinuxBootTime(hostfs resolve.Resolver) (uint64, error) {
-	if bootTime != 0 {
-		return bootTime, nil
+	if btime := atomic.LoadUint64(&bootTime); btime != 0 {
+		return btime, nil
 	}
 
 	path := hostfs.Join("proc", "stat")
@@ -414,7 +787,7 @@ func getLinuxBootTime(hostfs resolve.Resolver) (uint64, error) {
 			if err != nil {
 				return 0, fmt.Errorf("error reading boot time: %w", err)
 			}
-			bootTime = btime
+			atomic.StoreUint64(&bootTime, btime)
 			return btime, nil
 		}
 	}
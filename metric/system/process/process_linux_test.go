@@ -21,11 +21,19 @@
 package process
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/elastic/elastic-agent-libs/opt"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 	"github.com/stretchr/testify/assert"
@@ -97,3 +105,703 @@ func TestFetchProcessFromOtherUser(t *testing.T) {
 	require.NoError(t, err)
 	t.Logf("got: %s", pidData.StringToPrint())
 }
+
+func TestGetIOData(t *testing.T) {
+	io, err := getIOData(resolve.NewTestResolver("./testdata"), 1234)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(323934931), io.ReadChar.ValueOr(0))
+	assert.Equal(t, uint64(323929600), io.WriteChar.ValueOr(0))
+	assert.Equal(t, uint64(632687), io.ReadSyscalls.ValueOr(0))
+	assert.Equal(t, uint64(632675), io.WriteSyscalls.ValueOr(0))
+	assert.Equal(t, uint64(6508544), io.ReadBytes.ValueOr(0))
+	assert.Equal(t, uint64(323932160), io.WriteBytes.ValueOr(0))
+	assert.Equal(t, uint64(4096), io.CancelledWriteBytes.ValueOr(0))
+}
+
+func TestGetSchedStat(t *testing.T) {
+	sched, err := getSchedStat(resolve.NewTestResolver("./testdata"), 1234, ProcSchedInfo{Policy: "other"})
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(1520000000), sched.RunTimeNs.ValueOr(0))
+	assert.Equal(t, uint64(45000000), sched.WaitTimeNs.ValueOr(0))
+	assert.Equal(t, uint64(3200), sched.Timeslices.ValueOr(0))
+	assert.Equal(t, "other", sched.Policy, "existing fields should be kept")
+
+	// kernels without CONFIG_SCHED_INFO don't have the file
+	sched, err = getSchedStat(resolve.NewTestResolver("./testdata"), 1235, ProcSchedInfo{})
+	require.NoError(t, err)
+	assert.True(t, sched.IsZero())
+}
+
+func TestGetLimits(t *testing.T) {
+	limits, err := getLimits(resolve.NewTestResolver("./testdata"), 1234)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(1024), limits.Nofile.Soft.ValueOr(0))
+	assert.Equal(t, uint64(524288), limits.Nofile.Hard.ValueOr(0))
+	assert.Equal(t, uint64(8388608), limits.Stack.Soft.ValueOr(0))
+	assert.True(t, limits.Stack.HardUnlimited)
+	assert.False(t, limits.Stack.Hard.Exists())
+	assert.True(t, limits.CPU.SoftUnlimited)
+	assert.True(t, limits.CPU.HardUnlimited)
+	// a zero limit is not unlimited
+	assert.True(t, limits.Core.Soft.Exists())
+	assert.False(t, limits.Core.SoftUnlimited)
+	// rows without units
+	assert.True(t, limits.Nice.Hard.Exists())
+	assert.Equal(t, uint64(63445), limits.Sigpending.Soft.ValueOr(0))
+	assert.Equal(t, uint64(819200), limits.Msgqueue.Hard.ValueOr(0))
+	assert.True(t, limits.Rttime.SoftUnlimited)
+}
+
+func TestFillLimitUsage(t *testing.T) {
+	limits, err := getLimits(resolve.NewTestResolver("./testdata"), 1234)
+	require.NoError(t, err)
+
+	state := ProcState{
+		Limits:     limits,
+		FD:         ProcFDInfo{Open: opt.UintWith(256)},
+		NumThreads: opt.IntWith(634),
+		Memory:     ProcMemInfo{Size: opt.UintWith(4096000000)},
+	}
+	limits = fillLimitUsage(state)
+	assert.Equal(t, 0.25, limits.Nofile.UsedPct.ValueOr(0))
+	assert.Equal(t, 0.01, limits.Nproc.UsedPct.ValueOr(0))
+	assert.Equal(t, 0.5, limits.AS.UsedPct.ValueOr(0))
+	// no usage is known for the stack
+	assert.False(t, limits.Stack.UsedPct.Exists())
+
+	// unlimited address space
+	state.Limits.AS = ProcRlimit{SoftUnlimited: true, HardUnlimited: true}
+	limits = fillLimitUsage(state)
+	assert.False(t, limits.AS.UsedPct.Exists())
+}
+
+func TestGetSecurity(t *testing.T) {
+	hostfs := resolve.NewTestResolver("./testdata")
+	status, err := getProcStatus(hostfs, 1234)
+	require.NoError(t, err)
+
+	security, err := getSecurity(hostfs, 1234, status)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1000, security.UID.Real.ValueOr(-1))
+	assert.Equal(t, 0, security.UID.Effective.ValueOr(-1))
+	assert.Equal(t, 0, security.UID.Saved.ValueOr(-1))
+	assert.Equal(t, 1000, security.UID.FS.ValueOr(-1))
+	assert.Equal(t, 1000, security.GID.Effective.ValueOr(-1))
+	assert.Equal(t, []int{4, 27, 1000}, security.Groups)
+	// there's no /etc/group in the testdata
+	assert.Equal(t, []string{"4", "27", "1000"}, security.GroupNames)
+	assert.Equal(t, []string{"CAP_NET_BIND_SERVICE"}, security.Capabilities.Effective)
+	assert.Equal(t, []string{"CAP_NET_ADMIN", "CAP_NET_RAW"}, security.Capabilities.Permitted)
+	assert.Len(t, security.Capabilities.Bounding, 41)
+	assert.Equal(t, "filter", security.Seccomp)
+	assert.True(t, security.NoNewPrivs)
+	assert.Equal(t, "system_u:system_r:unconfined_service_t:s0", security.Label)
+
+	// no LSM label and a minimal status file
+	security, err = getSecurity(hostfs, 1235, map[string]string{"Uid": "0\t0\t0\t0", "CapEff": "0000000000000000"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, security.UID.Real.ValueOr(-1))
+	assert.Equal(t, []string{}, security.Capabilities.Effective)
+	assert.Empty(t, security.Label)
+	assert.False(t, security.IsZero())
+}
+
+func TestDecodeCapabilities(t *testing.T) {
+	caps, err := decodeCapabilities("0000000000000001")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CAP_CHOWN"}, caps)
+
+	// bits without a known name
+	caps, err = decodeCapabilities("8000020000000000")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CAP_41", "CAP_63"}, caps)
+
+	_, err = decodeCapabilities("xyz")
+	assert.Error(t, err)
+}
+
+func TestDecodeTTY(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sys", "dev", "char", "188:0"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sys", "dev", "char", "188:0", "uevent"), []byte("MAJOR=188\nMINOR=0\nDEVNAME=ttyUSB0\n"), 0o644))
+	hostfs := resolve.NewTestResolver(root)
+
+	for ttyNr, name := range map[uint64]string{
+		0x8803:            "pts/3",
+		0x8900:            "pts/256",
+		0x8802 | 0x100000: "pts/258",
+		0x0401:            "tty1",
+		0x0440:            "ttyS0",
+		0x0501:            "console",
+		0xbc00:            "",
+		0x0b00:            "",
+	} {
+		assert.Equal(t, name, decodeTTY(ttyNr).Name, "tty_nr %#x", ttyNr)
+	}
+
+	// other terminals are looked up in sysfs
+	assert.Equal(t, "ttyUSB0", getCharDeviceName(hostfs, 188, 0))
+	assert.Equal(t, "", getCharDeviceName(hostfs, 11, 0))
+}
+
+func TestGetAudit(t *testing.T) {
+	audit, err := getAudit(resolve.NewTestResolver("./testdata"), 1234)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, audit.LoginUID.ValueOr(0))
+	assert.Equal(t, uint64(3), audit.SessionID.ValueOr(0))
+
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 2)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "etc"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "etc", "passwd"), []byte("alice:x:1000:1000::/home/alice:/bin/sh\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1001", "loginuid"), []byte("1000"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1001", "sessionid"), []byte("12"), 0o644))
+	hostfs := resolve.NewTestResolver(root)
+
+	audit, err = getAudit(hostfs, 1001)
+	require.NoError(t, err)
+	assert.Equal(t, ProcAudit{LoginUID: opt.IntWith(1000), LoginUser: "alice", SessionID: opt.UintWith(12)}, audit)
+
+	// unset for daemons
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1002", "loginuid"), []byte("4294967295"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1002", "sessionid"), []byte("4294967295"), 0o644))
+	audit, err = getAudit(hostfs, 1002)
+	require.NoError(t, err)
+	assert.True(t, audit.IsZero())
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1002", "sessionid"), []byte("x"), 0o644))
+	_, err = getAudit(hostfs, 1002)
+	assert.ErrorIs(t, err, ErrParse)
+}
+
+func TestGetOOMScore(t *testing.T) {
+	oom, err := getOOMScore(resolve.NewTestResolver("./testdata"), 1234)
+	require.NoError(t, err)
+	assert.Equal(t, ProcOOMInfo{Score: opt.IntWith(668), ScoreAdj: opt.IntWith(-500)}, oom)
+
+	// procfs without an OOM killer
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 1)
+	hostfs := resolve.NewTestResolver(root)
+	oom, err = getOOMScore(hostfs, 1001)
+	require.NoError(t, err)
+	assert.True(t, oom.IsZero())
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1001", "oom_score"), []byte("high\n"), 0o644))
+	_, err = getOOMScore(hostfs, 1001)
+	assert.ErrorIs(t, err, ErrParse)
+}
+
+func TestGetInfoForPid(t *testing.T) {
+	state, err := GetInfoForPid(resolve.NewTestResolver("./testdata"), 1234)
+	require.NoError(t, err)
+
+	assert.Equal(t, "java", state.Name)
+	assert.Equal(t, Sleeping, state.State)
+	assert.Equal(t, 1, state.Ppid.ValueOr(0))
+	assert.Equal(t, 1234, state.Pgid.ValueOr(0))
+	assert.Equal(t, ProcSession{
+		ID:     opt.IntWith(1234),
+		Leader: true,
+		TTY:    ProcTTY{Name: "pts/0", Major: opt.IntWith(136), Minor: opt.IntWith(0)},
+	}, state.Session)
+	assert.NotEmpty(t, state.CPU.StartTime, "start time is needed to detect PID reuse")
+	assert.Equal(t, uint64(5000), state.startTicks.ValueOr(0))
+	assert.Equal(t, 2, state.NumThreads.ValueOr(0))
+	assert.Equal(t, uint64(2500), state.PageFaults.Minor.ValueOr(0))
+	assert.Equal(t, uint64(12), state.PageFaults.Major.ValueOr(0))
+	assert.Equal(t, uint64(0), state.PageFaults.ChildrenMinor.ValueOr(1))
+	assert.Equal(t, 20, state.Sched.Priority.ValueOr(0))
+	assert.Equal(t, 0, state.Sched.Nice.ValueOr(-1))
+	assert.Equal(t, "other", state.Sched.Policy)
+
+	// basic PID info doesn't need the boot time from /proc/stat
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 1)
+	require.NoError(t, os.Remove(filepath.Join(root, "proc", "stat")))
+	state, err = GetInfoForPid(resolve.NewTestResolver(root), 1001)
+	require.NoError(t, err)
+	assert.Equal(t, "worker-1", state.Name)
+	assert.True(t, state.startTicks.Exists())
+}
+
+func TestGetContextSwitches(t *testing.T) {
+	switches, err := getContextSwitches(map[string]string{
+		"voluntary_ctxt_switches":    "150",
+		"nonvoluntary_ctxt_switches": "7",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(150), switches.Voluntary.ValueOr(0))
+	assert.Equal(t, uint64(7), switches.Nonvoluntary.ValueOr(0))
+
+	// older kernels don't report the counters
+	switches, err = getContextSwitches(map[string]string{"Uid": "0 0 0 0"})
+	require.NoError(t, err)
+	assert.True(t, switches.IsZero())
+
+	_, err = getContextSwitches(map[string]string{"voluntary_ctxt_switches": "many"})
+	assert.Error(t, err)
+}
+
+func TestFetchPidsConcurrency(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 200)
+
+	sequential := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver(root),
+	}
+	require.NoError(t, sequential.Init())
+	seqMap, seqList, err := sequential.FetchPids()
+	require.NoError(t, err)
+	require.Len(t, seqList, 200)
+
+	parallel := Stats{
+		Procs:       []string{".*"},
+		Hostfs:      resolve.NewTestResolver(root),
+		Concurrency: 8,
+	}
+	require.NoError(t, parallel.Init())
+	parMap, parList, err := parallel.FetchPids()
+	require.NoError(t, err)
+	require.Len(t, parList, 200)
+	require.Len(t, parMap, len(seqMap))
+
+	for i := range seqList {
+		assert.Equal(t, seqList[i].Pid, parList[i].Pid, "processes should be returned in the same order")
+		assert.Equal(t, seqList[i].Name, parList[i].Name)
+		assert.Equal(t, seqList[i].Memory, parList[i].Memory)
+	}
+	// fd.limit is filled from the nofile rlimit
+	assert.Equal(t, uint64(1024), seqList[0].FD.Limit.Soft.ValueOr(0))
+	assert.Equal(t, uint64(4096), seqList[0].Limits.Nofile.Hard.ValueOr(0))
+
+	// filtering should still apply
+	filtered := Stats{
+		Procs:       []string{"worker-1.*"},
+		Hostfs:      resolve.NewTestResolver(root),
+		Concurrency: 8,
+	}
+	require.NoError(t, filtered.Init())
+	_, filteredList, err := filtered.FetchPids()
+	require.NoError(t, err)
+	// worker-1, worker-10..19, worker-100..199
+	assert.Len(t, filteredList, 111)
+}
+
+func BenchmarkFetchPids(b *testing.B) {
+	root := b.TempDir()
+	writeSyntheticProcfs(b, root, 5000)
+
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			stats := Stats{
+				Procs:       []string{".*"},
+				Hostfs:      resolve.NewTestResolver(root),
+				Concurrency: concurrency,
+			}
+			if err := stats.Init(); err != nil {
+				b.Fatalf("Failed init: %s", err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := stats.FetchPids(); err != nil {
+					b.Fatalf("error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetWithContextDeadline(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 3)
+
+	testStats := Stats{
+		Procs:          []string{".*"},
+		Hostfs:         resolve.NewTestResolver(root),
+		TrackLifecycle: true,
+	}
+	require.NoError(t, testStats.Init())
+	procs, _, err := testStats.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	procs, roots, err := testStats.GetWithContext(ctx)
+	var deadlineErr *DeadlineError
+	require.ErrorAs(t, err, &deadlineErr)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 3, deadlineErr.Skipped)
+	assert.Empty(t, procs)
+	assert.Empty(t, roots)
+
+	// skipped processes keep their previous samples, and aren't reported as exited
+	_, ok := testStats.ProcsMap.GetProcess(ProcState{Pid: opt.IntWith(1001)})
+	assert.True(t, ok)
+	assert.Empty(t, testStats.LifecycleEvents())
+
+	_, err = testStats.GetOneWithContext(ctx, 1001)
+	assert.ErrorAs(t, err, &deadlineErr)
+}
+
+func TestFetchPidsPidTimeout(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 3)
+	// reading a FIFO blocks until something writes to it
+	statm := filepath.Join(root, "proc", "1002", "statm")
+	require.NoError(t, os.Remove(statm))
+	require.NoError(t, syscall.Mkfifo(statm, 0o644))
+	t.Cleanup(func() {
+		// unblock the abandoned read
+		if fifo, err := os.OpenFile(statm, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			fifo.Close()
+		}
+	})
+
+	testStats := Stats{
+		Procs:      []string{".*"},
+		Hostfs:     resolve.NewTestResolver(root),
+		PidTimeout: 100 * time.Millisecond,
+	}
+	require.NoError(t, testStats.Init())
+	procMap, _, err := testStats.FetchPidsWithContext(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, procMap, 2)
+	assert.NotContains(t, procMap, 1002)
+
+	_, _, err = testStats.fillPidTimeout(context.Background(), nil, 1002, false)
+	assert.ErrorIs(t, err, ErrPidTimeout)
+}
+
+func TestFetchPidsPidTimeoutInFlight(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 3)
+	statm := filepath.Join(root, "proc", "1002", "statm")
+	statmData, err := os.ReadFile(statm)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(statm))
+	require.NoError(t, syscall.Mkfifo(statm, 0o644))
+
+	testStats := Stats{
+		Procs:      []string{".*"},
+		Hostfs:     resolve.NewTestResolver(root),
+		PidTimeout: 50 * time.Millisecond,
+	}
+	require.NoError(t, testStats.Init())
+	for i := 0; i < 5; i++ {
+		procMap, _, err := testStats.FetchPidsWithContext(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, procMap, 2)
+		assert.NotContains(t, procMap, 1002)
+	}
+	// only the first cycle started a fill that is still blocked on the read
+	assert.Equal(t, 1, testStats.inFlight.len())
+
+	// unblock the read, later reads get a regular file
+	fifo, err := os.OpenFile(statm, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(statm))
+	require.NoError(t, os.WriteFile(statm, statmData, 0o644))
+	fifo.Close()
+	require.Eventually(t, func() bool {
+		return testStats.inFlight.len() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	procMap, _, err := testStats.FetchPidsWithContext(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, procMap, 3)
+}
+
+func TestGetDegraded(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 3)
+	// fd is missing, and the limits can't be parsed
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "proc", "1001", "fd")))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1001", "limits"), []byte("Limit                     Soft Limit           Hard Limit           Units\n"+
+		"Max open files            lots                 4096                 files\n"), 0o644))
+
+	testStats := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver(root),
+	}
+	require.NoError(t, testStats.Init())
+	procs, _, err := testStats.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 3)
+	assert.Equal(t, CycleStats{Degraded: 1}, testStats.CycleStats())
+
+	state, ok := testStats.ProcsMap.GetPid(1001)
+	require.True(t, ok)
+	assert.Equal(t, []ProcDegradedField{
+		{Field: "limits", Reason: "parse_error"},
+		{Field: "fd", Reason: "unsupported"},
+	}, state.Degraded)
+	// the rest of the process is still filled out
+	assert.Equal(t, uint64(1001<<12), state.Memory.Size.ValueOr(0))
+	assert.Equal(t, "worker-1", state.Name)
+
+	state, ok = testStats.ProcsMap.GetPid(1002)
+	require.True(t, ok)
+	assert.Empty(t, state.Degraded)
+
+	// a process that exits while it's filled out is dropped, instead of being reported with most of its fields degraded
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "proc", "1003")))
+	err = degradeField(testStats.Hostfs, 1003, &state, "memory", os.ErrNotExist)
+	assert.ErrorIs(t, err, ProcNotExist)
+	var fieldErr *FieldError
+	require.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "memory", fieldErr.Field)
+	assert.Empty(t, state.Degraded)
+}
+
+func TestExcludeProcesses(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 5)
+	replace := func(pid, file, old, new string) {
+		path := filepath.Join(root, "proc", pid, file)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), old, new, 1)), 0o644))
+	}
+	// 1002 is the collector, and 1003 is its child
+	require.NoError(t, os.Symlink("1002", filepath.Join(root, "proc", "self")))
+	replace("1003", "stat", " S 1 ", " S 1002 ")
+	// 1004 is a kernel thread
+	replace("1004", "stat", " 4194560 ", " 2129984 ")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1004", "cmdline"), nil, 0o644))
+	require.NoError(t, os.Remove(filepath.Join(root, "proc", "1004", "exe")))
+	// 1005 runs as UID 1000
+	replace("1005", "status", "Uid:\t0\t0\t0\t0", "Uid:\t1000\t1000\t1000\t1000")
+
+	fetch := func(stats *Stats) ([]int, ProcsMap) {
+		require.NoError(t, stats.Init())
+		procMap, _, err := stats.FetchPids()
+		require.NoError(t, err)
+		var pids []int
+		for pid := range procMap {
+			pids = append(pids, pid)
+		}
+		sort.Ints(pids)
+		return pids, procMap
+	}
+
+	pids, procMap := fetch(&Stats{Procs: []string{".*"}, Hostfs: resolve.NewTestResolver(root)})
+	assert.Equal(t, []int{1001, 1002, 1003, 1004, 1005}, pids)
+	kthread := procMap[1004]
+	assert.True(t, kthread.IsKernelThread())
+	assert.Empty(t, kthread.Degraded, "a kernel thread without an executable is not degraded")
+	worker := procMap[1001]
+	assert.False(t, worker.IsKernelThread())
+
+	excluded := &Stats{
+		Procs:                []string{".*"},
+		Hostfs:               resolve.NewTestResolver(root),
+		ExcludeKernelThreads: true,
+		ExcludeSelf:          true,
+		ExcludeUIDs:          []int{1000},
+	}
+	pids, _ = fetch(excluded)
+	assert.Equal(t, []int{1001}, pids)
+}
+
+// writeSyntheticProcfs creates a procfs with the given number of processes, with enough files for FillPidMetrics.
+func TestGetHostfsUserNames(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 1)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "etc"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "etc", "passwd"), []byte("hostroot:x:0:0::/root:/bin/sh\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "etc", "group"), []byte("hostwheel:x:0:\n"), 0o644))
+
+	testStats := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver(root),
+	}
+	require.NoError(t, testStats.Init())
+
+	_, roots, err := testStats.Get()
+	require.NoError(t, err)
+	require.Len(t, roots, 1)
+	userName, err := roots[0].GetValue("user.name")
+	require.NoError(t, err)
+	assert.Equal(t, "hostroot", userName)
+	groupName, err := roots[0].GetValue("group.name")
+	require.NoError(t, err)
+	assert.Equal(t, "hostwheel", groupName)
+}
+
+func TestGetRedacted(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 1)
+	dir := filepath.Join(root, "proc", "1001")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "environ"), []byte("PATH=/usr/bin\x00API_TOKEN=hunter2\x00"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cmdline"), []byte("/usr/bin/worker\x00--password\x00hunter2\x00"), 0o644))
+
+	testStats := Stats{
+		Procs:        []string{".*"},
+		Hostfs:       resolve.NewTestResolver(root),
+		EnvWhitelist: []string{".*"},
+		CacheCmdLine: true,
+		Redact:       &RedactConfig{},
+	}
+	require.NoError(t, testStats.Init())
+
+	// the second cycle uses the cached command line and environment
+	for i := 0; i < 2; i++ {
+		procs, roots, err := testStats.Get()
+		require.NoError(t, err)
+		require.Len(t, procs, 1)
+		assert.NotContains(t, procs[0].String()+roots[0].String(), "hunter2")
+
+		token, err := procs[0].GetValue("env.API_TOKEN")
+		require.NoError(t, err)
+		assert.Equal(t, "[REDACTED]", token)
+		cmdline, err := roots[0].GetValue("process.command_line")
+		require.NoError(t, err)
+		assert.Equal(t, "/usr/bin/worker --password [REDACTED]", cmdline)
+	}
+	cached, ok := testStats.ProcsMap.GetPid(1001)
+	require.True(t, ok)
+	assert.Equal(t, []string{"/usr/bin/worker", "--password", "[REDACTED]"}, cached.Args)
+}
+
+func TestFetchPidsFilter(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 3)
+	// If FillPidMetrics ran for worker-3 it would fail, so this ensures the process is dropped before that.
+	require.NoError(t, os.Remove(filepath.Join(root, "proc", "1003", "statm")))
+
+	testStats := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver(root),
+		Filter: &FilterConfig{
+			Not: &FilterConfig{Name: "worker-3"},
+			// worker-1 has an RSS of 101 pages, and worker-2 102 pages
+			Metric: fmt.Sprintf("memory.rss.bytes > %d", 101*os.Getpagesize()),
+		},
+		TrackLifecycle: true,
+	}
+	require.NoError(t, testStats.Init())
+
+	status, saved, err := testStats.pidFill(1003, true)
+	require.NoError(t, err)
+	assert.False(t, saved)
+	assert.False(t, status.Memory.Size.Exists(), "process should be dropped before FillPidMetrics")
+
+	procs, roots, err := testStats.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 1)
+	name, err := roots[0].GetValue("process.name")
+	require.NoError(t, err)
+	assert.Equal(t, "worker-2", name)
+
+	// worker-1 was filled out before being dropped, so it's tracked for percentages but isn't reported anywhere else
+	_, ok := testStats.ProcsMap.GetPid(1001)
+	assert.False(t, ok)
+	_, ok = testStats.ProcsMap.GetProcess(ProcState{Pid: opt.IntWith(1001)})
+	assert.True(t, ok)
+	_, ok = testStats.ProcsMap.GetProcess(ProcState{Pid: opt.IntWith(1003)})
+	assert.False(t, ok)
+	_, _, err = testStats.Get()
+	require.NoError(t, err)
+	events := testStats.LifecycleEvents()
+	assert.Empty(t, events, "filtered processes should not produce lifecycle events")
+}
+
+func TestGetProcessTree(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 3)
+	// worker-2 and worker-3 are children of worker-1
+	for _, pid := range []string{"1002", "1003"} {
+		path := filepath.Join(root, "proc", pid, "stat")
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), " S 1 ", " S 1001 ", 1)), 0o644))
+	}
+
+	testStats := Stats{
+		Procs:      []string{".*"},
+		Hostfs:     resolve.NewTestResolver(root),
+		EnableTree: true,
+	}
+	require.NoError(t, testStats.Init())
+	procs, roots, err := testStats.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 3)
+
+	pageSize := uint64(os.Getpagesize())
+	for i, proc := range procs {
+		pid, err := roots[i].GetValue("process.pid")
+		require.NoError(t, err)
+		rss, err := proc.GetValue("tree.memory.rss.bytes")
+		require.NoError(t, err)
+		descendants, err := proc.GetValue("tree.descendants")
+		require.NoError(t, err)
+		if pid == 1001 {
+			assert.Equal(t, (101+102+103)*pageSize, rss)
+			assert.Equal(t, 2, descendants)
+		} else {
+			assert.Equal(t, 0, descendants)
+		}
+	}
+
+	tree := testStats.ProcessTree()
+	assert.Equal(t, []int{1001}, tree.Roots())
+	assert.Equal(t, []int{1002, 1003}, tree.Children(1001))
+	assert.Equal(t, []int{1001}, tree.Ancestors(1003))
+}
+
+func TestGetGrouped(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 3)
+
+	testStats := Stats{
+		Procs:   []string{".*"},
+		Hostfs:  resolve.NewTestResolver(root),
+		GroupBy: GroupByExe,
+	}
+	require.NoError(t, testStats.Init())
+	procs, roots, err := testStats.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 1)
+
+	count, err := procs[0].GetValue("group.count")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	rss, err := procs[0].GetValue("memory.rss.bytes")
+	require.NoError(t, err)
+	assert.Equal(t, (101+102+103)*uint64(os.Getpagesize()), rss)
+	exe, err := roots[0].GetValue("process.executable")
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/worker", exe)
+}
+
+func writeSyntheticProcfs(t testing.TB, root string, count int) {
+	write := func(path string, data string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	}
+
+	write(filepath.Join(root, "proc", "stat"), "cpu  2255 34 2290 22625563 6290 127 456 0 0 0\nbtime 1700000000\n")
+	for i := 1; i <= count; i++ {
+		pid := strconv.Itoa(i + 1000)
+		dir := filepath.Join(root, "proc", pid)
+		write(filepath.Join(dir, "stat"), fmt.Sprintf("%s (worker-%d) S 1 %s %s 0 -1 4194560 2500 0 12 0 %d 30 0 0 20 0 1 0 5000 "+
+			"4096000000 52000 18446744073709551615 1 1 0 0 0 0 0 4096 1260 0 0 0 17 3 0 0 0 0 0 0 0 0 0 0 0 0 0\n", pid, i, pid, pid, i*10))
+		write(filepath.Join(dir, "statm"), fmt.Sprintf("%d %d 300 100 0 500 0\n", 1000+i, 100+i))
+		write(filepath.Join(dir, "status"), fmt.Sprintf("Name:\tworker-%d\nState:\tS (sleeping)\nUid:\t0\t0\t0\t0\nGid:\t0\t0\t0\t0\n", i))
+		write(filepath.Join(dir, "cmdline"), fmt.Sprintf("/usr/bin/worker\x00--id\x00%d\x00", i))
+		write(filepath.Join(dir, "environ"), "PATH=/usr/bin\x00")
+		write(filepath.Join(dir, "io"), "rchar: 1000\nwchar: 500\nsyscr: 10\nsyscw: 5\nread_bytes: 4096\nwrite_bytes: 0\ncancelled_write_bytes: 0\n")
+		write(filepath.Join(dir, "limits"), "Limit                     Soft Limit           Hard Limit           Units\n"+
+			"Max open files            1024                 4096                 files\n")
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "fd"), 0o755))
+		require.NoError(t, os.Symlink("/usr/bin/worker", filepath.Join(dir, "exe")))
+		require.NoError(t, os.Symlink("/", filepath.Join(dir, "cwd")))
+	}
+}
@@ -21,9 +21,14 @@
 package process
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
+	"syscall"
 	"testing"
 	"time"
 
@@ -33,8 +38,11 @@ import (
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/mapstr"
 	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-libs/transform/typeconv"
 	"github.com/elastic/elastic-agent-system-metrics/metric"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup/cgv1"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup/cgv2"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 )
 
@@ -264,6 +272,124 @@ func TestProcMemPercentage(t *testing.T) {
 	assert.Equal(t, rssPercent.ValueOr(0), 0.1416)
 }
 
+func TestProcsTrackPidReuse(t *testing.T) {
+	track := NewProcsTrack()
+	track.SetPid(100, ProcState{
+		Pid:  opt.IntWith(100),
+		Args: []string{"old"},
+		CPU:  ProcCPUInfo{StartTime: "2023-01-01T12:00:00.000Z"},
+	})
+
+	_, ok := track.GetProcess(ProcState{Pid: opt.IntWith(100), CPU: ProcCPUInfo{StartTime: "2023-01-01T12:00:00.000Z"}})
+	assert.True(t, ok, "same process should be found")
+	_, ok = track.GetProcess(ProcState{Pid: opt.IntWith(100), CPU: ProcCPUInfo{StartTime: "2023-01-01T13:00:00.000Z"}})
+	assert.False(t, ok, "a process that reused the PID should not get the old entry")
+	_, ok = track.GetProcess(ProcState{Pid: opt.IntWith(100), CPU: ProcCPUInfo{StartTime: ""}})
+	assert.True(t, ok, "unknown start time should fall back to the PID")
+
+	procStats := Stats{CacheCmdLine: true, ProcsMap: track}
+	reused := procStats.cacheCmdLine(ProcState{Pid: opt.IntWith(100), CPU: ProcCPUInfo{StartTime: "2023-01-01T13:00:00.000Z"}})
+	assert.Empty(t, reused.Args, "cmdline from a previous owner of the PID should not be cached")
+	same := procStats.cacheCmdLine(ProcState{Pid: opt.IntWith(100), CPU: ProcCPUInfo{StartTime: "2023-01-01T12:00:00.000Z"}})
+	assert.Equal(t, []string{"old"}, same.Args)
+
+	// Start ticks tell apart processes that started within the same second
+	track.SetPid(200, ProcState{Pid: opt.IntWith(200), CPU: ProcCPUInfo{StartTime: "2023-01-01T12:00:00.000Z"}, startTicks: opt.UintWith(5000)})
+	_, ok = track.GetProcess(ProcState{Pid: opt.IntWith(200), CPU: ProcCPUInfo{StartTime: "2023-01-01T12:00:00.000Z"}, startTicks: opt.UintWith(5030)})
+	assert.False(t, ok, "a process with different start ticks should not get the old entry")
+	_, ok = track.GetProcess(ProcState{Pid: opt.IntWith(200), CPU: ProcCPUInfo{StartTime: "2023-01-01T12:00:00.000Z"}, startTicks: opt.UintWith(5000)})
+	assert.True(t, ok)
+}
+
+func TestProcsTrackTTL(t *testing.T) {
+	track := NewProcsTrack()
+	track.ttl = time.Millisecond * 10
+
+	track.SetPid(1, ProcState{})
+	time.Sleep(time.Millisecond * 20)
+	track.SetPid(2, ProcState{})
+
+	_, ok := track.GetPid(1)
+	assert.False(t, ok, "stale entry should be evicted")
+	_, ok = track.GetPid(2)
+	assert.True(t, ok)
+
+	// entries from SetMap aren't subject to the TTL
+	track.SetMap(ProcsMap{3: {}})
+	time.Sleep(time.Millisecond * 20)
+	track.SetPid(4, ProcState{})
+	_, ok = track.GetPid(3)
+	assert.True(t, ok)
+}
+
+func TestFieldErrorKind(t *testing.T) {
+	_, numErr := strconv.ParseUint("lots", 10, 64)
+	tests := map[string]struct {
+		err    error
+		kind   error
+		reason string
+	}{
+		"permission":  {err: fmt.Errorf("error opening file: %w", os.ErrPermission), kind: ErrPermissionDenied, reason: "permission_denied"},
+		"errno":       {err: &os.PathError{Op: "open", Path: "/proc/1/io", Err: syscall.EACCES}, kind: ErrPermissionDenied, reason: "permission_denied"},
+		"missing":     {err: &os.PathError{Op: "open", Path: "/proc/1/io", Err: syscall.ENOENT}, kind: ErrUnsupported, reason: "unsupported"},
+		"number":      {err: fmt.Errorf("error parsing limit: %w", numErr), kind: ErrParse, reason: "parse_error"},
+		"parse":       {err: fmt.Errorf("%w: expected more fields", ErrParse), kind: ErrParse, reason: "parse_error"},
+		"gone":        {err: syscall.ESRCH, kind: ProcNotExist, reason: "error"},
+		"unsupported": {err: ErrUnsupported, kind: ErrUnsupported, reason: "unsupported"},
+		"other":       {err: errors.New("something else"), kind: nil, reason: "error"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fieldErr := newFieldError("io", tc.err)
+			assert.Equal(t, tc.kind, fieldErr.Kind)
+			assert.Equal(t, tc.reason, fieldErr.reason())
+			assert.ErrorIs(t, fieldErr, tc.err)
+			if tc.kind != nil {
+				assert.ErrorIs(t, fmt.Errorf("FillPidMetrics: %w", fieldErr), tc.kind)
+			}
+		})
+	}
+}
+
+func TestFormatForRoot(t *testing.T) {
+	state := ProcState{
+		Name:     "bash",
+		Pid:      opt.IntWith(4321),
+		Username: "root",
+		Session: ProcSession{
+			ID:  opt.IntWith(4000),
+			TTY: ProcTTY{Name: "pts/3", Major: opt.IntWith(136), Minor: opt.IntWith(3)},
+		},
+		Audit: ProcAudit{LoginUID: opt.IntWith(1000), LoginUser: "alice", SessionID: opt.UintWith(12)},
+	}
+
+	rootMap := mapstr.M{}
+	require.NoError(t, typeconv.Convert(&rootMap, state.FormatForRoot()))
+	for key, value := range map[string]interface{}{
+		"user.name":                     "root",
+		"user.audit.id":                 "1000",
+		"user.audit.name":               "alice",
+		"process.session_leader.pid":    4000,
+		"process.tty.char_device.major": 136,
+		"process.tty.char_device.minor": 3,
+	} {
+		actual, err := rootMap.GetValue(key)
+		require.NoError(t, err, key)
+		assert.EqualValues(t, value, actual, key)
+	}
+
+	// the session and audit identity stay in the integration-level event
+	assert.Equal(t, "pts/3", state.Session.TTY.Name)
+	assert.Equal(t, uint64(12), state.Audit.SessionID.ValueOr(0))
+
+	rootMap = mapstr.M{}
+	require.NoError(t, typeconv.Convert(&rootMap, (&ProcState{Name: "systemd"}).FormatForRoot()))
+	for _, key := range []string{"process.session_leader", "process.tty", "user.audit"} {
+		_, err := rootMap.GetValue(key)
+		assert.ErrorIs(t, err, mapstr.ErrKeyNotFound, key)
+	}
+}
+
 func TestProcCpuPercentage(t *testing.T) {
 	p1 := ProcState{
 		CPU: ProcCPUInfo{
@@ -298,6 +424,77 @@ func TestProcCpuPercentage(t *testing.T) {
 	assert.EqualValues(t, 3.459, newState.CPU.Total.Pct.ValueOr(0))
 }
 
+func TestProcIORates(t *testing.T) {
+	p1 := ProcState{
+		IO: ProcIOInfo{
+			ReadBytes:  opt.UintWith(1000),
+			WriteBytes: opt.UintWith(5000),
+			WriteChar:  opt.UintWith(100),
+		},
+		SampleTime: time.Now(),
+	}
+
+	p2 := ProcState{
+		IO: ProcIOInfo{
+			ReadBytes:  opt.UintWith(3000),
+			WriteBytes: opt.UintWith(5000),
+			WriteChar:  opt.UintWith(50),
+		},
+		SampleTime: p1.SampleTime.Add(time.Second * 2),
+	}
+
+	newState := GetProcIORates(p1, p2)
+	assert.EqualValues(t, 1000, newState.IO.PerSec.ReadBytes.ValueOr(0))
+	assert.EqualValues(t, 0, newState.IO.PerSec.WriteBytes.ValueOr(-1))
+	// counter went backwards
+	assert.False(t, newState.IO.PerSec.WriteChar.Exists())
+	// counter was never reported
+	assert.False(t, newState.IO.PerSec.ReadChar.Exists())
+}
+
+func TestProcActivityRates(t *testing.T) {
+	p1 := ProcState{
+		PageFaults:      ProcPageFaults{Minor: opt.UintWith(1000), Major: opt.UintWith(10)},
+		ContextSwitches: ProcContextSwitches{Voluntary: opt.UintWith(500), Nonvoluntary: opt.UintWith(20)},
+		SampleTime:      time.Now(),
+	}
+
+	p2 := ProcState{
+		PageFaults:      ProcPageFaults{Minor: opt.UintWith(1400), Major: opt.UintWith(10)},
+		ContextSwitches: ProcContextSwitches{Voluntary: opt.UintWith(700), Nonvoluntary: opt.UintWith(10)},
+		SampleTime:      p1.SampleTime.Add(time.Second * 4),
+	}
+
+	newState := GetProcActivityRates(p1, p2)
+	assert.EqualValues(t, 100, newState.PageFaults.PerSec.Minor.ValueOr(0))
+	assert.EqualValues(t, 0, newState.PageFaults.PerSec.Major.ValueOr(-1))
+	assert.EqualValues(t, 50, newState.ContextSwitches.PerSec.Voluntary.ValueOr(0))
+	// counter went backwards
+	assert.False(t, newState.ContextSwitches.PerSec.Nonvoluntary.Exists())
+	// raw counters are left alone
+	assert.EqualValues(t, 1400, newState.PageFaults.Minor.ValueOr(0))
+}
+
+func TestProcSchedDelay(t *testing.T) {
+	p1 := ProcState{
+		Sched:      ProcSchedInfo{WaitTimeNs: opt.UintWith(1000000000)},
+		SampleTime: time.Now(),
+	}
+
+	p2 := ProcState{
+		Sched:      ProcSchedInfo{WaitTimeNs: opt.UintWith(1500000000)},
+		SampleTime: p1.SampleTime.Add(time.Second * 2),
+	}
+
+	newState := GetProcSchedDelay(p1, p2)
+	assert.EqualValues(t, 500000000, newState.Sched.Delay.Ns.ValueOr(0))
+	assert.EqualValues(t, 0.25, newState.Sched.Delay.Pct.ValueOr(0))
+
+	// no schedstat in the previous sample
+	newState = GetProcSchedDelay(ProcState{SampleTime: p1.SampleTime}, p2)
+	assert.True(t, newState.Sched.Delay.IsZero())
+}
+
 // BenchmarkGetProcess runs a benchmark of the GetProcess method with caching
 // of the command line and environment variables.
 func BenchmarkGetProcess(b *testing.B) {
@@ -555,6 +752,159 @@ func TestIncludeTopProcesses(t *testing.T) {
 	}
 }
 
+func TestIncludeTopProcessesByIO(t *testing.T) {
+	processes := []ProcState{}
+	for pid, rate := range []float64{10, 500, 40, 0, 300} {
+		processes = append(processes, ProcState{
+			Pid: opt.IntWith(pid + 1),
+			CPU: ProcCPUInfo{Total: CPUTotal{Pct: opt.FloatWith(float64(pid))}},
+			IO:  ProcIOInfo{PerSec: ProcIORates{ReadBytes: opt.FloatWith(rate / 2), WriteBytes: opt.FloatWith(rate / 2)}},
+		})
+	}
+
+	procStats := Stats{IncludeTop: IncludeTopConfig{Enabled: true, ByIO: 2}}
+	resPids := []int{}
+	for _, p := range procStats.includeTopProcesses(processes) {
+		resPids = append(resPids, p.Pid.ValueOr(0))
+	}
+	sort.Ints(resPids)
+	assert.Equal(t, []int{2, 5}, resPids)
+
+	procStats = Stats{IncludeTop: IncludeTopConfig{Enabled: true, ByCPU: 1, ByIO: 2}}
+	resPids = []int{}
+	for _, p := range procStats.includeTopProcesses(processes) {
+		resPids = append(resPids, p.Pid.ValueOr(0))
+	}
+	sort.Ints(resPids)
+	assert.Equal(t, []int{2, 5}, resPids)
+}
+
+func TestIncludeTopProcessesByPSS(t *testing.T) {
+	processes := []ProcState{}
+	for pid, pss := range []uint64{3000, 100, 9000, 7000, 0} {
+		processes = append(processes, ProcState{
+			Pid: opt.IntWith(pid + 1),
+			// RSS ranks the processes in the opposite order, so the results show which value was used
+			Memory: ProcMemInfo{Rss: MemBytePct{Bytes: opt.UintWith(10000 - pss)}, Pss: opt.UintWith(pss)},
+		})
+	}
+
+	procStats := Stats{IncludeTop: IncludeTopConfig{Enabled: true, ByPSS: 2}}
+	resPids := []int{}
+	for _, p := range procStats.includeTopProcesses(processes) {
+		resPids = append(resPids, p.Pid.ValueOr(0))
+	}
+	sort.Ints(resPids)
+	assert.Equal(t, []int{3, 4}, resPids)
+
+	procStats = Stats{IncludeTop: IncludeTopConfig{Enabled: true, ByMemory: 1, ByPSS: 2}}
+	resPids = []int{}
+	for _, p := range procStats.includeTopProcesses(processes) {
+		resPids = append(resPids, p.Pid.ValueOr(0))
+	}
+	sort.Ints(resPids)
+	assert.Equal(t, []int{3, 4, 5}, resPids)
+}
+
+func TestOOMHeadroom(t *testing.T) {
+	mib := uint64(1024 * 1024)
+
+	v2 := &cgroup.StatsV2{Memory: &cgv2.MemorySubsystem{}}
+	v2.Memory.Mem.Usage.Bytes = 900 * mib
+	v2.Memory.Stats.InactiveFile.Bytes = 100 * mib
+	v2.Memory.Mem.Max.Bytes = opt.UintWith(1000 * mib)
+	// the inactive page cache is reclaimed before the OOM killer is invoked
+	assert.Equal(t, ProcOOMHeadroom{Bytes: opt.UintWith(200 * mib), Pct: opt.FloatWith(0.2), Limit: opt.UintWith(1000 * mib)}, getOOMHeadroom(v2, opt.NewUintNone()))
+
+	v2.Memory.Mem.Usage.Bytes = 1200 * mib
+	assert.Equal(t, ProcOOMHeadroom{Bytes: opt.UintWith(0), Pct: opt.FloatWith(0), Limit: opt.UintWith(1000 * mib)}, getOOMHeadroom(v2, opt.NewUintNone()))
+
+	// a lower limit of a parent cgroup applies
+	v2.Memory.Mem.Usage.Bytes = 400 * mib
+	assert.Equal(t, ProcOOMHeadroom{Bytes: opt.UintWith(200 * mib), Pct: opt.FloatWith(0.4), Limit: opt.UintWith(500 * mib)}, getOOMHeadroom(v2, opt.UintWith(500*mib)))
+	assert.Equal(t, opt.UintWith(1000*mib), getOOMHeadroom(v2, opt.UintWith(2000*mib)).Limit)
+
+	v2.Memory.Mem.Max.Bytes = opt.NewUintNone()
+	assert.True(t, getOOMHeadroom(v2, opt.NewUintNone()).IsZero(), "memory.max is max")
+	assert.Equal(t, opt.UintWith(500*mib), getOOMHeadroom(v2, opt.UintWith(500*mib)).Limit)
+	assert.True(t, getOOMHeadroom(&cgroup.StatsV2{}, opt.UintWith(mib)).IsZero(), "memory controller isn't enabled")
+
+	v1 := &cgroup.StatsV1{Memory: &cgv1.MemorySubsystem{}}
+	v1.Memory.Mem.Usage.Bytes = 300 * mib
+	v1.Memory.Mem.Limit.Bytes = 9223372036854771712
+	assert.True(t, getOOMHeadroom(v1, opt.NewUintNone()).IsZero(), "no limit")
+
+	// the limit of a parent cgroup applies
+	v1.Memory.Stats.HierarchicalMemoryLimit.Bytes = 400 * mib
+	assert.Equal(t, ProcOOMHeadroom{Bytes: opt.UintWith(100 * mib), Pct: opt.FloatWith(0.25), Limit: opt.UintWith(400 * mib)}, getOOMHeadroom(v1, opt.NewUintNone()))
+}
+
+func TestGetAncestorMemoryMax(t *testing.T) {
+	root := t.TempDir()
+	leaf := filepath.Join(root, "user.slice", "user-1000.slice", "session-3.scope")
+	require.NoError(t, os.MkdirAll(leaf, 0o755))
+	for dir, max := range map[string]string{
+		filepath.Join(root, "user.slice"):                    "max\n",
+		filepath.Join(root, "user.slice", "user-1000.slice"): "536870912\n",
+		leaf: "268435456\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.max"), []byte(max), 0o644))
+	}
+
+	// the limit of the cgroup itself is in its memory stats, the root cgroup has none
+	assert.Equal(t, opt.UintWith(536870912), getAncestorMemoryMax(leaf))
+	assert.Equal(t, opt.NewUintNone(), getAncestorMemoryMax(filepath.Join(root, "user.slice")))
+}
+
+func TestIncludeTopProcessesByOOMRisk(t *testing.T) {
+	processes := []ProcState{
+		{Pid: opt.IntWith(1), OOM: ProcOOMInfo{Score: opt.IntWith(900)}},
+		{Pid: opt.IntWith(2), OOM: ProcOOMInfo{Score: opt.IntWith(100), Headroom: ProcOOMHeadroom{Pct: opt.FloatWith(0.5)}}},
+		{Pid: opt.IntWith(3), OOM: ProcOOMInfo{Score: opt.IntWith(50), Headroom: ProcOOMHeadroom{Pct: opt.FloatWith(0.05)}}},
+		{Pid: opt.IntWith(4), OOM: ProcOOMInfo{Score: opt.IntWith(200), Headroom: ProcOOMHeadroom{Pct: opt.FloatWith(0.05)}}},
+		{Pid: opt.IntWith(5), OOM: ProcOOMInfo{Score: opt.IntWith(0), ScoreAdj: opt.IntWith(-1000), Headroom: ProcOOMHeadroom{Pct: opt.FloatWith(0)}}},
+		{Pid: opt.IntWith(6), OOM: ProcOOMInfo{Score: opt.IntWith(300)}},
+	}
+
+	for n, expected := range map[int][]int{
+		2: {4, 3},
+		4: {4, 3, 2, 1},
+		6: {4, 3, 2, 1, 6, 5},
+	} {
+		procStats := Stats{IncludeTop: IncludeTopConfig{Enabled: true, ByOOMRisk: n}}
+		resPids := []int{}
+		for _, p := range procStats.includeTopProcesses(processes) {
+			resPids = append(resPids, p.Pid.ValueOr(0))
+		}
+		assert.Equal(t, expected, resPids)
+	}
+}
+
+func TestIncludeTopProcessesGrouped(t *testing.T) {
+	processes := []ProcState{}
+	for pid, name := range []string{"nginx", "php-fpm", "nginx", "nginx", "php-fpm", "redis"} {
+		processes = append(processes, ProcState{
+			Pid:    opt.IntWith(pid + 1),
+			Name:   name,
+			Memory: ProcMemInfo{Rss: MemBytePct{Bytes: opt.UintWith(uint64(1000 * (pid + 1)))}},
+		})
+	}
+
+	// redis has the single largest process, but nginx uses the most memory as a group
+	procStats := Stats{IncludeTop: IncludeTopConfig{Enabled: true, ByMemory: 2}}
+	top := procStats.includeTopProcesses(groupProcesses(processes, GroupByName))
+	require.Len(t, top, 2)
+	assert.Equal(t, "nginx", top[0].Name)
+	assert.Equal(t, uint64(8000), top[0].Memory.Rss.Bytes.ValueOr(0))
+	assert.Equal(t, "php-fpm", top[1].Name)
+	assert.Equal(t, uint64(7000), top[1].Memory.Rss.Bytes.ValueOr(0))
+
+	// groups selected by both CPU and memory are only included once
+	procStats = Stats{IncludeTop: IncludeTopConfig{Enabled: true, ByCPU: 3, ByMemory: 3}}
+	top = procStats.includeTopProcesses(groupProcesses(processes, GroupByName))
+	assert.Len(t, top, 3)
+}
+
 func initTestResolver() (Stats, error) {
 	err := logp.DevelopmentSetup()
 	if err != nil {
@@ -18,6 +18,7 @@
 package process
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/elastic/elastic-agent-libs/mapstr"
@@ -32,9 +33,11 @@ type ProcState struct {
 	Name     string   `struct:"name,omitempty"`
 	State    PidState `struct:"state,omitempty"`
 	Username string   `struct:"username,omitempty"`
-	Pid      opt.Int  `struct:"pid,omitempty"`
-	Ppid     opt.Int  `struct:"ppid,omitempty"`
-	Pgid     opt.Int  `struct:"pgid,omitempty"`
+	// Groupname is the name of the real group, linux only
+	Groupname string  `struct:"groupname,omitempty"`
+	Pid       opt.Int `struct:"pid,omitempty"`
+	Ppid      opt.Int `struct:"ppid,omitempty"`
+	Pgid      opt.Int `struct:"pgid,omitempty"`
 
 	// Extended Process Data
 	Args    []string `struct:"args,omitempty"`
@@ -47,13 +50,73 @@ type ProcState struct {
 	Memory  ProcMemInfo                       `struct:"memory,omitempty"`
 	CPU     ProcCPUInfo                       `struct:"cpu,omitempty"`
 	FD      ProcFDInfo                        `struct:"fd,omitempty"`
+	IO      ProcIOInfo                        `struct:"io,omitempty"`
 	Network *sysinfotypes.NetworkCountersInfo `struct:"-,omitempty"`
 
+	// Page faults and context switches, linux only
+	PageFaults      ProcPageFaults      `struct:"page_faults,omitempty"`
+	ContextSwitches ProcContextSwitches `struct:"context_switches,omitempty"`
+
+	// Scheduling settings and run queue latency, linux only
+	Sched ProcSchedInfo `struct:"sched,omitempty"`
+
+	// Resource limits from /proc/[PID]/limits, linux only
+	Limits ProcResourceLimits `struct:"limits,omitempty"`
+
+	// Security context, linux only
+	Security ProcSecurity `struct:"security,omitempty"`
+
+	// OOM killer score and the memory headroom of the cgroup, linux only
+	OOM ProcOOMInfo `struct:"oom,omitempty"`
+
+	// Session, controlling terminal and audit login identity, linux only
+	Session ProcSession `struct:"session,omitempty"`
+	Audit   ProcAudit   `struct:"audit,omitempty"`
+
+	// Namespaces and container identity, linux only
+	Namespaces ProcNamespaces `struct:"namespaces,omitempty"`
+	Container  ProcContainer  `struct:"container,omitempty"`
+
+	// Socket inventory, linux only
+	Sockets ProcSockets `struct:"sockets,omitempty"`
+
+	// Executable file metadata and hashes, linux only
+	ExeInfo ProcExeInfo `struct:"exe_info,omitempty"`
+
+	// Summary of the memory mappings, linux only
+	Maps ProcMapsInfo `struct:"maps,omitempty"`
+
 	// cgroups
 	Cgroup cgroup.CGStats `struct:"cgroup,omitempty"`
 
+	NumThreads opt.Int `struct:"num_threads,omitempty"`
+	// Optional per-thread data
+	Threads []ThreadState `struct:"threads,omitempty"`
+
+	// Optional resource usage of the process and its descendants
+	Tree ProcTreeInfo `struct:"tree,omitempty"`
+
+	// Set instead of the process data when processes are grouped, see Stats.GroupBy
+	Group ProcGroupInfo `struct:"group,omitempty"`
+
+	// Fields that couldn't be filled out, the rest of the process data is still valid
+	Degraded []ProcDegradedField `struct:"degraded,omitempty"`
+
 	// meta
 	SampleTime time.Time `struct:"-,omitempty"`
+	// startTicks is the start time of the process in clock ticks since boot, where available.
+	// Unlike CPU.StartTime, it doesn't depend on the boot time, and has sub-second precision.
+	startTicks opt.Uint
+	// kernelThread is set from the PF_KTHREAD flag, see IsKernelThread
+	kernelThread bool
+}
+
+// ThreadState is the struct for per-thread metrics, as reported by /proc/[PID]/task/[TID]
+type ThreadState struct {
+	Tid   opt.Int     `struct:"tid,omitempty"`
+	Name  string      `struct:"name,omitempty"`
+	State PidState    `struct:"state,omitempty"`
+	CPU   ProcCPUInfo `struct:"cpu,omitempty"`
 }
 
 // ProcCPUInfo is the main struct for CPU metrics
@@ -83,6 +146,17 @@ type ProcMemInfo struct {
 	Size  opt.Uint   `struct:"size,omitempty"`
 	Share opt.Uint   `struct:"share,omitempty"`
 	Rss   MemBytePct `struct:"rss,omitempty"`
+
+	// Optional metrics from /proc/[PID]/smaps_rollup
+	// Pss is the proportional set size, where each shared page is divided between the processes sharing it
+	Pss opt.Uint `struct:"pss,omitempty"`
+	// Uss is the unique set size, the memory that is private to the process
+	Uss       opt.Uint `struct:"uss,omitempty"`
+	Swap      opt.Uint `struct:"swap,omitempty"`
+	SwapPss   opt.Uint `struct:"swap_pss,omitempty"`
+	Anonymous opt.Uint `struct:"anonymous,omitempty"`
+	// FileBacked is the proportional share of file-backed memory, excluding shmem and tmpfs.
+	FileBacked opt.Uint `struct:"file_backed,omitempty"`
 }
 
 // MemBytePct is the formatting struct for wrapping pct/byte metrics
@@ -103,6 +177,365 @@ type ProcLimits struct {
 	Hard opt.Uint `struct:"hard,omitempty"`
 }
 
+// ProcResourceLimits is the struct for all the resource limits of a process, see getrlimit(2).
+// The fd.limit metrics keep using ProcLimits.
+type ProcResourceLimits struct {
+	CPU        ProcRlimit `struct:"cpu,omitempty"`
+	FileSize   ProcRlimit `struct:"fsize,omitempty"`
+	Data       ProcRlimit `struct:"data,omitempty"`
+	Stack      ProcRlimit `struct:"stack,omitempty"`
+	Core       ProcRlimit `struct:"core,omitempty"`
+	RSS        ProcRlimit `struct:"rss,omitempty"`
+	Nproc      ProcRlimit `struct:"nproc,omitempty"`
+	Nofile     ProcRlimit `struct:"nofile,omitempty"`
+	Memlock    ProcRlimit `struct:"memlock,omitempty"`
+	AS         ProcRlimit `struct:"as,omitempty"`
+	Locks      ProcRlimit `struct:"locks,omitempty"`
+	Sigpending ProcRlimit `struct:"sigpending,omitempty"`
+	Msgqueue   ProcRlimit `struct:"msgqueue,omitempty"`
+	Nice       ProcRlimit `struct:"nice,omitempty"`
+	Rtprio     ProcRlimit `struct:"rtprio,omitempty"`
+	Rttime     ProcRlimit `struct:"rttime,omitempty"`
+}
+
+// ProcRlimit is the struct for the soft and hard values of one resource limit.
+// An unlimited value is reported with the Unlimited flag instead of a number.
+type ProcRlimit struct {
+	Soft          opt.Uint `struct:"soft,omitempty"`
+	Hard          opt.Uint `struct:"hard,omitempty"`
+	SoftUnlimited bool     `struct:"soft_unlimited,omitempty"`
+	HardUnlimited bool     `struct:"hard_unlimited,omitempty"`
+	// UsedPct is the current usage as a fraction of the soft limit, where the usage is known
+	UsedPct opt.Float `struct:"used_pct,omitempty"`
+}
+
+// ProcSecurity is the struct for the security context of a process
+type ProcSecurity struct {
+	UID ProcSecurityIDs `struct:"uid,omitempty"`
+	GID ProcSecurityIDs `struct:"gid,omitempty"`
+	// Groups are the supplementary group IDs, and GroupNames their names
+	Groups       []int            `struct:"groups,omitempty"`
+	GroupNames   []string         `struct:"group_names,omitempty"`
+	Capabilities ProcCapabilities `struct:"capabilities,omitempty"`
+	// Seccomp is the seccomp mode: "disabled", "strict" or "filter"
+	Seccomp    string `struct:"seccomp,omitempty"`
+	NoNewPrivs bool   `struct:"no_new_privs"`
+	// Label is the SELinux context or AppArmor profile from /proc/[PID]/attr/current
+	Label string `struct:"label,omitempty"`
+}
+
+// ProcOOMInfo is the struct for the OOM killer score of a process
+type ProcOOMInfo struct {
+	// Score is the badness from /proc/[PID]/oom_score, the OOM killer picks the process with the highest score
+	Score opt.Int `struct:"score,omitempty"`
+	// ScoreAdj is the adjustment of the score from /proc/[PID]/oom_score_adj, -1000 means the process is never killed
+	ScoreAdj opt.Int `struct:"score_adj,omitempty"`
+	// Headroom is the memory left before the memory cgroup of the process runs into its limit. This requires Stats.EnableCgroups.
+	Headroom ProcOOMHeadroom `struct:"headroom,omitempty"`
+}
+
+// ProcOOMHeadroom is the struct for the memory left in the memory cgroup of a process.
+// Usage is the working set of the cgroup, which leaves out the inactive page cache, as that is reclaimed before the OOM killer is invoked.
+type ProcOOMHeadroom struct {
+	Bytes opt.Uint `struct:"bytes,omitempty"`
+	// Pct is the headroom as a fraction of the limit
+	Pct opt.Float `struct:"pct,omitempty"`
+	// Limit is the lowest memory limit of the cgroup and its parents
+	Limit opt.Uint `struct:"limit,omitempty"`
+}
+
+// ProcSession is the struct for the session and controlling terminal of a process
+type ProcSession struct {
+	// ID is the process ID of the session leader
+	ID     opt.Int `struct:"id,omitempty"`
+	Leader bool    `struct:"leader,omitempty"`
+	TTY    ProcTTY `struct:"tty,omitempty"`
+}
+
+// ProcTTY is the struct for the controlling terminal of a process
+type ProcTTY struct {
+	// Name is the device name relative to /dev, such as pts/3 or tty1
+	Name  string  `struct:"name,omitempty"`
+	Major opt.Int `struct:"major,omitempty"`
+	Minor opt.Int `struct:"minor,omitempty"`
+}
+
+// ProcAudit is the struct for the audit login identity of a process, from /proc/[PID]/loginuid and /proc/[PID]/sessionid.
+// It's inherited from the login session, and isn't changed by su or sudo.
+type ProcAudit struct {
+	LoginUID  opt.Int  `struct:"login_uid,omitempty"`
+	LoginUser string   `struct:"login_user,omitempty"`
+	SessionID opt.Uint `struct:"session_id,omitempty"`
+}
+
+// ProcSecurityIDs is the struct for the real, effective, saved and filesystem user or group IDs
+type ProcSecurityIDs struct {
+	Real      opt.Int `struct:"real,omitempty"`
+	Effective opt.Int `struct:"effective,omitempty"`
+	Saved     opt.Int `struct:"saved,omitempty"`
+	FS        opt.Int `struct:"fs,omitempty"`
+}
+
+// ProcCapabilities is the struct for the capability sets of a process, by name
+type ProcCapabilities struct {
+	Effective []string `struct:"effective,omitempty"`
+	Permitted []string `struct:"permitted,omitempty"`
+	Bounding  []string `struct:"bounding,omitempty"`
+}
+
+// ProcNamespaces is the struct for the inode numbers of the namespaces of a process, from /proc/[PID]/ns.
+// Processes with the same inode number share a namespace.
+type ProcNamespaces struct {
+	Pid    opt.Uint `struct:"pid,omitempty"`
+	Net    opt.Uint `struct:"net,omitempty"`
+	Mnt    opt.Uint `struct:"mnt,omitempty"`
+	Uts    opt.Uint `struct:"uts,omitempty"`
+	Ipc    opt.Uint `struct:"ipc,omitempty"`
+	User   opt.Uint `struct:"user,omitempty"`
+	Cgroup opt.Uint `struct:"cgroup,omitempty"`
+}
+
+// ProcContainer is the struct for the container a process runs in
+type ProcContainer struct {
+	// Runtime is one of docker, containerd, cri-o, podman or lxc. It is empty if the ID was found
+	// in a path that doesn't tell the runtime apart, e.g. kubernetes with the cgroupfs driver.
+	Runtime string `struct:"runtime,omitempty"`
+	ID      string `struct:"id,omitempty"`
+	// PodUID is the UID of the kubernetes pod of the container
+	PodUID string `struct:"pod_uid,omitempty"`
+}
+
+// ProcSockets is the struct for the sockets held open by a process
+type ProcSockets struct {
+	// Listening are the addresses of the listening TCP sockets and the unconnected UDP sockets
+	Listening []ProcSocketAddr `struct:"listening,omitempty"`
+	// Connections counts the other TCP sockets by state, e.g. "established" or "time_wait"
+	Connections map[string]int `struct:"connections,omitempty"`
+	UDP         opt.Int        `struct:"udp,omitempty"`
+	Unix        opt.Int        `struct:"unix,omitempty"`
+	// Remote are the remote endpoints of the connected sockets, only reported if SocketRemoteEndpoints is set
+	Remote []ProcSocketAddr `struct:"remote,omitempty"`
+}
+
+// ProcSocketAddr is the struct for a socket address
+type ProcSocketAddr struct {
+	// Protocol is one of tcp, tcp6, udp or udp6
+	Protocol string `struct:"protocol"`
+	IP       string `struct:"ip"`
+	Port     int    `struct:"port"`
+}
+
+// ProcMapsInfo is the struct for the summary of the memory mappings of a process, from /proc/[PID]/smaps
+type ProcMapsInfo struct {
+	// Count is the number of mappings, which can't exceed the vm.max_map_count sysctl, reported as MaxCount
+	Count    opt.Int   `struct:"count,omitempty"`
+	MaxCount opt.Int   `struct:"max_count,omitempty"`
+	UsedPct  opt.Float `struct:"used_pct,omitempty"`
+
+	Heap      ProcMapsUsage `struct:"heap,omitempty"`
+	Stack     ProcMapsUsage `struct:"stack,omitempty"`
+	Anonymous ProcMapsUsage `struct:"anonymous,omitempty"`
+	File      ProcMapsUsage `struct:"file,omitempty"`
+	Shmem     ProcMapsUsage `struct:"shmem,omitempty"`
+	Vdso      ProcMapsUsage `struct:"vdso,omitempty"`
+
+	// Files are the file-backed mappings summed up per file, such as every library, by descending size
+	Files []ProcMapsFile `struct:"files,omitempty"`
+	// Deleted are the files that were deleted or replaced on disk, but are still mapped
+	Deleted []ProcMapsFile `struct:"deleted,omitempty"`
+	// Largest are the largest mappings, see MapsConfig.TopN
+	Largest []ProcMapping `struct:"largest,omitempty"`
+}
+
+// ProcMapsUsage is the struct for the mappings of one kind. Rss is only known if smaps could be read.
+type ProcMapsUsage struct {
+	Count opt.Int  `struct:"count,omitempty"`
+	Size  opt.Uint `struct:"size,omitempty"`
+	Rss   opt.Uint `struct:"rss,omitempty"`
+}
+
+// ProcMapsFile is the struct for the mappings of a single file
+type ProcMapsFile struct {
+	Path  string   `struct:"path"`
+	Count int      `struct:"count"`
+	Size  uint64   `struct:"size"`
+	Rss   opt.Uint `struct:"rss,omitempty"`
+}
+
+// ProcMapping is the struct for a single memory mapping
+type ProcMapping struct {
+	// Address is the address range of the mapping, as reported by the kernel
+	Address string `struct:"address"`
+	Perms   string `struct:"perms"`
+	// Kind is one of heap, stack, anonymous, file, shmem or vdso
+	Kind    string   `struct:"kind"`
+	Path    string   `struct:"path,omitempty"`
+	Deleted bool     `struct:"deleted,omitempty"`
+	Size    uint64   `struct:"size"`
+	Rss     opt.Uint `struct:"rss,omitempty"`
+}
+
+// ProcDegradedField is the struct for a field of a process that couldn't be filled out
+type ProcDegradedField struct {
+	Field string `struct:"field"`
+	// Reason is one of permission_denied, parse_error, unsupported or error
+	Reason string `struct:"reason"`
+}
+
+// ProcExeInfo is the struct for the file metadata and hashes of the executable of a process
+type ProcExeInfo struct {
+	Size   opt.Uint `struct:"size,omitempty"`
+	Mtime  string   `struct:"mtime,omitempty"`
+	Inode  opt.Uint `struct:"inode,omitempty"`
+	Device opt.Uint `struct:"device,omitempty"`
+	// Deleted is true if the executable was deleted or replaced on disk since the process started, e.g. by an upgrade
+	Deleted bool        `struct:"deleted,omitempty"`
+	Hash    ProcExeHash `struct:"hash,omitempty"`
+}
+
+// ProcExeHash is the struct for the hashes of an executable, only the configured algorithms are set
+type ProcExeHash struct {
+	MD5    string `struct:"md5,omitempty"`
+	SHA1   string `struct:"sha1,omitempty"`
+	SHA256 string `struct:"sha256,omitempty"`
+}
+
+// ProcIOInfo is the struct for I/O counters from /proc/[PID]/io
+type ProcIOInfo struct {
+	// ReadChar is bytes read from the system, as passed from read() and similar syscalls
+	ReadChar opt.Uint `struct:"read_char,omitempty"`
+	// WriteChar is bytes written to the system, as passed to write() and similar syscalls
+	WriteChar opt.Uint `struct:"write_char,omitempty"`
+	// ReadSyscalls counts the number of read operations
+	ReadSyscalls opt.Uint `struct:"read_ops,omitempty"`
+	// WriteSyscalls counts the number of write operations
+	WriteSyscalls opt.Uint `struct:"write_ops,omitempty"`
+	// ReadBytes is the count of bytes that were actually fetched from the storage layer
+	ReadBytes opt.Uint `struct:"read_bytes,omitempty"`
+	// WriteBytes is the count of bytes that were actually sent to the storage layer
+	WriteBytes opt.Uint `struct:"write_bytes,omitempty"`
+	// CancelledWriteBytes is the number of bytes this process caused to not be written, by truncating pagecache
+	CancelledWriteBytes opt.Uint `struct:"cancelled_write_bytes,omitempty"`
+
+	// PerSec holds the rates of the counters above, calculated against the previous sample
+	PerSec ProcIORates `struct:"per_sec,omitempty"`
+}
+
+// ProcIORates is the struct for the per-second rates of the /proc/[PID]/io counters
+type ProcIORates struct {
+	ReadChar            opt.Float `struct:"read_char,omitempty"`
+	WriteChar           opt.Float `struct:"write_char,omitempty"`
+	ReadSyscalls        opt.Float `struct:"read_ops,omitempty"`
+	WriteSyscalls       opt.Float `struct:"write_ops,omitempty"`
+	ReadBytes           opt.Float `struct:"read_bytes,omitempty"`
+	WriteBytes          opt.Float `struct:"write_bytes,omitempty"`
+	CancelledWriteBytes opt.Float `struct:"cancelled_write_bytes,omitempty"`
+}
+
+// ProcPageFaults is the struct for the page fault counters from /proc/[PID]/stat
+type ProcPageFaults struct {
+	// Minor faults were served without loading a page from disk
+	Minor opt.Uint `struct:"minor,omitempty"`
+	// Major faults required loading a page from disk
+	Major opt.Uint `struct:"major,omitempty"`
+	// ChildrenMinor and ChildrenMajor are the faults of the children of the process that it has waited for
+	ChildrenMinor opt.Uint `struct:"children_minor,omitempty"`
+	ChildrenMajor opt.Uint `struct:"children_major,omitempty"`
+
+	PerSec ProcPageFaultRates `struct:"per_sec,omitempty"`
+}
+
+// ProcPageFaultRates is the struct for the per-second rates of page faults
+type ProcPageFaultRates struct {
+	Minor opt.Float `struct:"minor,omitempty"`
+	Major opt.Float `struct:"major,omitempty"`
+}
+
+// ProcContextSwitches is the struct for the context switch counters from /proc/[PID]/status
+type ProcContextSwitches struct {
+	// Voluntary switches happen when the process waits for a resource
+	Voluntary opt.Uint `struct:"voluntary,omitempty"`
+	// Nonvoluntary switches happen when the process is preempted by the scheduler
+	Nonvoluntary opt.Uint `struct:"nonvoluntary,omitempty"`
+
+	PerSec ProcContextSwitchRates `struct:"per_sec,omitempty"`
+}
+
+// ProcContextSwitchRates is the struct for the per-second rates of context switches
+type ProcContextSwitchRates struct {
+	Voluntary    opt.Float `struct:"voluntary,omitempty"`
+	Nonvoluntary opt.Float `struct:"nonvoluntary,omitempty"`
+}
+
+// ProcSchedInfo is the struct for the scheduling settings of a process and the time it spent waiting to run
+type ProcSchedInfo struct {
+	Nice     opt.Int `struct:"nice,omitempty"`
+	Priority opt.Int `struct:"priority,omitempty"`
+	// Policy is the scheduling policy, e.g. "other", "fifo" or "rr"
+	Policy string `struct:"policy,omitempty"`
+	// CPUsAllowed is the CPU affinity of the process in list format, e.g. "0-3,8"
+	CPUsAllowed string `struct:"cpus_allowed,omitempty"`
+
+	// Cumulative values from /proc/[PID]/schedstat, which needs a kernel built with CONFIG_SCHED_INFO
+	RunTimeNs  opt.Uint `struct:"run_time_ns,omitempty"`
+	WaitTimeNs opt.Uint `struct:"wait_time_ns,omitempty"`
+	Timeslices opt.Uint `struct:"timeslices,omitempty"`
+
+	// Delay is the time spent waiting on a run queue since the previous sample
+	Delay ProcSchedDelay `struct:"delay,omitempty"`
+}
+
+// ProcSchedDelay is the struct for the run queue delay between two samples.
+// Pct is the delay as a fraction of wall time, and is summed over all threads,
+// so it can be larger than 1 for multi-threaded processes.
+type ProcSchedDelay struct {
+	Ns  opt.Uint  `struct:"ns,omitempty"`
+	Pct opt.Float `struct:"pct,omitempty"`
+}
+
+// ProcTreeInfo is the struct for process.tree metrics, the resources used by a process and all of its descendants
+type ProcTreeInfo struct {
+	// Children is the number of direct children of the process
+	Children opt.Int `struct:"children,omitempty"`
+	// Descendants is the number of processes below the process in the tree
+	Descendants opt.Int        `struct:"descendants,omitempty"`
+	CPU         ProcTreeCPU    `struct:"cpu,omitempty"`
+	Memory      ProcTreeMemory `struct:"memory,omitempty"`
+	FD          ProcTreeFD     `struct:"fd,omitempty"`
+	Threads     opt.Int        `struct:"threads,omitempty"`
+}
+
+// ProcTreeCPU is the struct for process.tree.cpu metrics
+type ProcTreeCPU struct {
+	Pct  opt.Float  `struct:"pct,omitempty"`
+	Norm opt.PctOpt `struct:"norm,omitempty"`
+}
+
+// ProcTreeMemory is the struct for process.tree.memory metrics
+type ProcTreeMemory struct {
+	Rss MemBytePct `struct:"rss,omitempty"`
+}
+
+// ProcTreeFD is the struct for process.tree.fd metrics
+type ProcTreeFD struct {
+	Open opt.Uint `struct:"open,omitempty"`
+}
+
+// ProcGroupInfo is the struct for process.group metrics, set on the summary of a group of processes
+type ProcGroupInfo struct {
+	By  GroupBy `struct:"by,omitempty"`
+	Key string  `struct:"key,omitempty"`
+	// Count is the number of processes in the group
+	Count     opt.Int            `struct:"count,omitempty"`
+	StartTime ProcGroupStartTime `struct:"start_time,omitempty"`
+}
+
+// ProcGroupStartTime is the struct for the start times of the oldest and newest process in a group
+type ProcGroupStartTime struct {
+	Min string `struct:"min,omitempty"`
+	Max string `struct:"max,omitempty"`
+}
+
 // Implementations
 
 func (t CPUTotal) IsZero() bool {
@@ -119,6 +552,172 @@ func (t ProcFDInfo) IsZero() bool {
 	return t.Open.IsZero() && t.Limit.Hard.IsZero() && t.Limit.Soft.IsZero()
 }
 
+// IsZero returns true if no resource limits were collected
+func (t ProcResourceLimits) IsZero() bool {
+	return t == ProcResourceLimits{}
+}
+
+// IsZero returns true if the limit wasn't reported
+func (t ProcRlimit) IsZero() bool {
+	return t == ProcRlimit{}
+}
+
+// IsZero returns true if the OOM score wasn't reported
+func (t ProcOOMInfo) IsZero() bool {
+	return t.Score.IsZero() && t.ScoreAdj.IsZero() && t.Headroom.IsZero()
+}
+
+// IsZero returns true if the cgroup of the process has no memory limit
+func (t ProcOOMHeadroom) IsZero() bool {
+	return t.Bytes.IsZero() && t.Pct.IsZero() && t.Limit.IsZero()
+}
+
+// IsZero returns true if the session wasn't reported
+func (t ProcSession) IsZero() bool {
+	return t.ID.IsZero() && !t.Leader && t.TTY.IsZero()
+}
+
+// IsZero returns true if the process has no controlling terminal
+func (t ProcTTY) IsZero() bool {
+	return t.Name == "" && t.Major.IsZero() && t.Minor.IsZero()
+}
+
+// IsZero returns true if the process has no audit login identity
+func (t ProcAudit) IsZero() bool {
+	return t.LoginUID.IsZero() && t.LoginUser == "" && t.SessionID.IsZero()
+}
+
+// IsZero returns true if no security context was collected
+func (t ProcSecurity) IsZero() bool {
+	return t.UID.IsZero() && t.GID.IsZero() && len(t.Groups) == 0 && len(t.GroupNames) == 0 && t.Capabilities.IsZero() &&
+		t.Seccomp == "" && !t.NoNewPrivs && t.Label == ""
+}
+
+// IsZero returns true if the IDs weren't reported
+func (t ProcSecurityIDs) IsZero() bool {
+	return t == ProcSecurityIDs{}
+}
+
+// IsZero returns true if the capability sets weren't reported
+func (t ProcCapabilities) IsZero() bool {
+	return t.Effective == nil && t.Permitted == nil && t.Bounding == nil
+}
+
+// IsZero returns true if no namespaces were collected
+func (t ProcNamespaces) IsZero() bool {
+	return t == ProcNamespaces{}
+}
+
+// IsZero returns true if the process doesn't run in a known container
+func (t ProcContainer) IsZero() bool {
+	return t == ProcContainer{}
+}
+
+// IsZero returns true if the process has no known sockets
+func (t ProcSockets) IsZero() bool {
+	return len(t.Listening) == 0 && len(t.Connections) == 0 && t.UDP.IsZero() && t.Unix.IsZero() && len(t.Remote) == 0
+}
+
+// IsZero returns true if the executable wasn't read
+func (t ProcExeInfo) IsZero() bool {
+	return t == ProcExeInfo{}
+}
+
+// IsZero returns true if the executable wasn't hashed
+func (t ProcExeHash) IsZero() bool {
+	return t == ProcExeHash{}
+}
+
+// IsZero returns true if no mappings were read, every other field is only set along with Count
+func (t ProcMapsInfo) IsZero() bool {
+	return t.Count.IsZero()
+}
+
+// IsZero returns true if there are no mappings of this kind
+func (t ProcMapsUsage) IsZero() bool {
+	return t == ProcMapsUsage{}
+}
+
+// IsZero returns true if no I/O counters were collected
+func (t ProcIOInfo) IsZero() bool {
+	return t.ReadChar.IsZero() && t.WriteChar.IsZero() && t.ReadSyscalls.IsZero() && t.WriteSyscalls.IsZero() &&
+		t.ReadBytes.IsZero() && t.WriteBytes.IsZero() && t.CancelledWriteBytes.IsZero() && t.PerSec.IsZero()
+}
+
+// IsZero returns true if no I/O rates were calculated
+func (t ProcIORates) IsZero() bool {
+	return t.ReadChar.IsZero() && t.WriteChar.IsZero() && t.ReadSyscalls.IsZero() && t.WriteSyscalls.IsZero() &&
+		t.ReadBytes.IsZero() && t.WriteBytes.IsZero() && t.CancelledWriteBytes.IsZero()
+}
+
+// IsZero returns true if no page fault counters were collected
+func (t ProcPageFaults) IsZero() bool {
+	return t.Minor.IsZero() && t.Major.IsZero() && t.ChildrenMinor.IsZero() && t.ChildrenMajor.IsZero() && t.PerSec.IsZero()
+}
+
+// IsZero returns true if no page fault rates were calculated
+func (t ProcPageFaultRates) IsZero() bool {
+	return t.Minor.IsZero() && t.Major.IsZero()
+}
+
+// IsZero returns true if no context switch counters were collected
+func (t ProcContextSwitches) IsZero() bool {
+	return t.Voluntary.IsZero() && t.Nonvoluntary.IsZero() && t.PerSec.IsZero()
+}
+
+// IsZero returns true if no context switch rates were calculated
+func (t ProcContextSwitchRates) IsZero() bool {
+	return t.Voluntary.IsZero() && t.Nonvoluntary.IsZero()
+}
+
+// IsZero returns true if no scheduling data was collected
+func (t ProcSchedInfo) IsZero() bool {
+	return t.Nice.IsZero() && t.Priority.IsZero() && t.Policy == "" && t.CPUsAllowed == "" &&
+		t.RunTimeNs.IsZero() && t.WaitTimeNs.IsZero() && t.Timeslices.IsZero() && t.Delay.IsZero()
+}
+
+// IsZero returns true if the run queue delay wasn't calculated
+func (t ProcSchedDelay) IsZero() bool {
+	return t.Ns.IsZero() && t.Pct.IsZero()
+}
+
+// IsZero returns true if the process tree wasn't built
+func (t ProcTreeInfo) IsZero() bool {
+	return t.Children.IsZero() && t.Descendants.IsZero() && t.CPU.IsZero() && t.Memory.IsZero() &&
+		t.FD.IsZero() && t.Threads.IsZero()
+}
+
+// IsZero returns true if no CPU percentages were summed
+func (t ProcTreeCPU) IsZero() bool {
+	return t.Pct.IsZero() && t.Norm.IsZero()
+}
+
+// IsZero returns true if no memory metrics were summed
+func (t ProcTreeMemory) IsZero() bool {
+	return t.Rss.Bytes.IsZero() && t.Rss.Pct.IsZero()
+}
+
+// IsZero returns true if no FD counts were summed
+func (t ProcTreeFD) IsZero() bool {
+	return t.Open.IsZero()
+}
+
+// IsZero returns true if the process isn't a group summary
+func (t ProcGroupInfo) IsZero() bool {
+	return t.Count.IsZero()
+}
+
+// IsZero returns true if no start times were known
+func (t ProcGroupStartTime) IsZero() bool {
+	return t.Min == "" && t.Max == ""
+}
+
+// IsKernelThread returns true if the process is a kernel thread, such as kthreadd and its kworker children.
+// This is only known on linux, where it's set by GetInfoForPid.
+func (p *ProcState) IsKernelThread() bool {
+	return p.kernelThread
+}
+
 func (p *ProcState) FormatForRoot() ProcStateRootEvent {
 	root := ProcStateRootEvent{}
 
@@ -137,6 +736,9 @@ func (p *ProcState) FormatForRoot() ProcStateRootEvent {
 	root.User.Name = p.Username
 	p.Username = ""
 
+	root.Group.Name = p.Groupname
+	p.Groupname = ""
+
 	root.Process.Cmdline = p.Cmdline
 	root.Process.State = p.State
 	root.Process.CPU.StartTime = p.CPU.StartTime
@@ -152,13 +754,22 @@ func (p *ProcState) FormatForRoot() ProcStateRootEvent {
 	root.Process.Args = p.Args
 	p.Args = nil
 
+	root.Process.SessionLeader.Pid = p.Session.ID
+	root.Process.TTY.CharDevice.Major = p.Session.TTY.Major
+	root.Process.TTY.CharDevice.Minor = p.Session.TTY.Minor
+	if p.Audit.LoginUID.Exists() {
+		root.User.Audit.ID = strconv.Itoa(p.Audit.LoginUID.ValueOr(0))
+	}
+	root.User.Audit.Name = p.Audit.LoginUser
+
 	return root
 }
 
 // ProcStateRootEvent represents the "root" beat/agent ECS event fields that are copied from the integration-level event.
 type ProcStateRootEvent struct {
 	Process ProcessRoot `struct:"process,omitempty"`
-	User    Name        `struct:"user,omitempty"`
+	User    RootUser    `struct:"user,omitempty"`
+	Group   Name        `struct:"group,omitempty"`
 }
 
 // ProcessRoot wraps the process metrics for the root ECS fields
@@ -174,16 +785,67 @@ type ProcessRoot struct {
 	Pid     opt.Int       `struct:"pid,omitempty"`
 	Parent  Parent        `struct:"parent,omitempty"`
 	Pgid    opt.Int       `struct:"pgid,omitempty"`
+	// SessionLeader and TTY identify the login session, linux only
+	SessionLeader SessionLeader `struct:"session_leader,omitempty"`
+	TTY           RootTTY       `struct:"tty,omitempty"`
 }
 
 type Parent struct {
 	Pid opt.Int `struct:"pid,omitempty"`
 }
 
+// SessionLeader is the leader of the session of a process
+type SessionLeader struct {
+	Pid opt.Int `struct:"pid,omitempty"`
+}
+
+// IsZero returns true if the session is unknown
+func (t SessionLeader) IsZero() bool {
+	return t.Pid.IsZero()
+}
+
 type Name struct {
 	Name string `struct:"name,omitempty"`
 }
 
+// RootUser is the user of the process, and the user that originally logged in to the session, as reported by the audit subsystem
+type RootUser struct {
+	Name  string   `struct:"name,omitempty"`
+	Audit RootName `struct:"audit,omitempty"`
+}
+
+// RootName is an ID and name pair
+type RootName struct {
+	ID   string `struct:"id,omitempty"`
+	Name string `struct:"name,omitempty"`
+}
+
+// IsZero returns true if neither the ID nor the name are known
+func (t RootName) IsZero() bool {
+	return t.ID == "" && t.Name == ""
+}
+
+// RootTTY is the controlling terminal of the process
+type RootTTY struct {
+	CharDevice RootCharDevice `struct:"char_device,omitempty"`
+}
+
+// IsZero returns true if the process has no controlling terminal
+func (t RootTTY) IsZero() bool {
+	return t.CharDevice.IsZero()
+}
+
+// RootCharDevice is the device number of a character device
+type RootCharDevice struct {
+	Major opt.Int `struct:"major,omitempty"`
+	Minor opt.Int `struct:"minor,omitempty"`
+}
+
+// IsZero returns true if the device number is unknown
+func (t RootCharDevice) IsZero() bool {
+	return t.Major.IsZero() && t.Minor.IsZero()
+}
+
 type RootCPUFields struct {
 	StartTime string    `struct:"start_time,omitempty"`
 	Pct       opt.Float `struct:"pct,omitempty"`
@@ -70,10 +70,10 @@ func GetInfoForPid(_ resolve.Resolver, pid int) (ProcState, error) {
 }
 
 // FillPidMetrics is the windows implementation
-func FillPidMetrics(_ resolve.Resolver, pid int, state ProcState, _ func(string) bool) (ProcState, error) {
+func FillPidMetrics(hostfs resolve.Resolver, pid int, state ProcState, _ func(string) bool) (ProcState, error) {
 	user, err := getProcCredName(pid)
-	if err != nil {
-		return state, fmt.Errorf("error fetching username: %w", err)
+	if gone := degradeField(hostfs, pid, &state, "username", err); gone != nil {
+		return state, fmt.Errorf("error fetching username: %w", gone)
 	}
 	state.Username = user
 
@@ -81,26 +81,29 @@ func FillPidMetrics(_ resolve.Resolver, pid int, state ProcState, _ func(string)
 	state.Ppid = opt.IntWith(ppid)
 
 	wss, size, err := procMem(pid)
-	if err != nil {
-		return state, fmt.Errorf("error fetching memory: %w", err)
+	if gone := degradeField(hostfs, pid, &state, "memory", err); gone != nil {
+		return state, fmt.Errorf("error fetching memory: %w", gone)
+	}
+	if err == nil {
+		state.Memory.Rss.Bytes = opt.UintWith(wss)
+		state.Memory.Size = opt.UintWith(size)
 	}
-	state.Memory.Rss.Bytes = opt.UintWith(wss)
-	state.Memory.Size = opt.UintWith(size)
 
 	userTime, sysTime, startTime, err := getProcTimes(pid)
-	if err != nil {
-		return state, fmt.Errorf("error getting CPU times: %w", err)
+	if gone := degradeField(hostfs, pid, &state, "cpu", err); gone != nil {
+		return state, fmt.Errorf("error getting CPU times: %w", gone)
 	}
+	if err == nil {
+		state.CPU.System.Ticks = opt.UintWith(sysTime)
+		state.CPU.User.Ticks = opt.UintWith(userTime)
+		state.CPU.Total.Ticks = opt.UintWith(userTime + sysTime)
 
-	state.CPU.System.Ticks = opt.UintWith(sysTime)
-	state.CPU.User.Ticks = opt.UintWith(userTime)
-	state.CPU.Total.Ticks = opt.UintWith(userTime + sysTime)
-
-	state.CPU.StartTime = unixTimeMsToTime(startTime)
+		state.CPU.StartTime = unixTimeMsToTime(startTime)
+	}
 
 	argList, err := getProcArgs(pid)
-	if err != nil {
-		return state, fmt.Errorf("error fetching process args: %w", err)
+	if gone := degradeField(hostfs, pid, &state, "args", err); gone != nil {
+		return state, fmt.Errorf("error fetching process args: %w", gone)
 	}
 	state.Args = argList
 	return state, nil
@@ -0,0 +1,177 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// redactedPlaceholder replaces secrets, hashed secrets look like "[REDACTED:<hash>]"
+const redactedPlaceholder = "[REDACTED]"
+
+// redactor replaces the secrets in the environment and command line of a process.
+// Redacting a value twice leaves it unchanged, as values from the cmdline cache have already been redacted.
+type redactor struct {
+	keys   []string
+	values []*regexp.Regexp
+	hash   bool
+	salt   string
+}
+
+// newRedactor compiles a RedactConfig
+func newRedactor(cfg RedactConfig) (*redactor, error) {
+	r := &redactor{hash: cfg.Hash, salt: cfg.Salt}
+
+	keys := cfg.Keys
+	if len(keys) == 0 {
+		keys = DefaultRedactKeys
+	}
+	for _, key := range keys {
+		pattern := strings.ToUpper(key)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid key pattern '%s': %w", key, err)
+		}
+		r.keys = append(r.keys, pattern)
+	}
+
+	values := cfg.Values
+	if len(values) == 0 {
+		values = DefaultRedactValues
+	}
+	for _, value := range values {
+		reg, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value pattern '%s': %w", value, err)
+		}
+		if reg.NumSubexp() > 1 {
+			return nil, fmt.Errorf("value pattern '%s' has more than one capture group", value)
+		}
+		r.values = append(r.values, reg)
+	}
+
+	return r, nil
+}
+
+// redactProcess redacts the environment, arguments and command line of a process
+func (r *redactor) redactProcess(state ProcState) ProcState {
+	if state.Env != nil {
+		// the map is shared with the previous sample in ProcsMap, so a new one is needed
+		env := make(mapstr.M, len(state.Env))
+		for key, value := range state.Env {
+			if str, ok := value.(string); ok {
+				value = r.redactEnv(key, str)
+			}
+			env[key] = value
+		}
+		state.Env = env
+	}
+	if len(state.Args) > 0 {
+		state.Args = r.redactArgs(state.Args)
+	}
+	if state.Cmdline != "" {
+		// value patterns can span several arguments, e.g. "Bearer <token>"
+		state.Cmdline = r.redactValue(strings.Join(r.redactArgs(strings.Split(state.Cmdline, " ")), " "))
+	}
+	return state
+}
+
+// redactEnv redacts the value of an environment variable
+func (r *redactor) redactEnv(key, value string) string {
+	if r.matchKey(key) {
+		return r.secret(value)
+	}
+	return r.redactValue(value)
+}
+
+// redactArgs returns a redacted copy of a command line.
+// Secret flags are redacted in both the "--password=secret" and "--password secret" forms.
+func (r *redactor) redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	secretNext := false
+	for i, arg := range args {
+		switch {
+		case secretNext && arg != "" && !strings.HasPrefix(arg, "-"):
+			redacted[i] = r.secret(arg)
+			secretNext = false
+			continue
+		case arg != "":
+			secretNext = false
+		}
+
+		if key, value, ok := strings.Cut(arg, "="); ok && r.matchKey(strings.TrimLeft(key, "-")) {
+			redacted[i] = key + "=" + r.secret(value)
+			continue
+		}
+		if strings.HasPrefix(arg, "-") && r.matchKey(strings.TrimLeft(arg, "-")) {
+			secretNext = true
+		}
+		redacted[i] = r.redactValue(arg)
+	}
+	return redacted
+}
+
+// redactValue redacts the parts of a value that match the value patterns
+func (r *redactor) redactValue(value string) string {
+	for _, reg := range r.values {
+		value = reg.ReplaceAllStringFunc(value, func(match string) string {
+			if reg.NumSubexp() == 0 {
+				return r.secret(match)
+			}
+			sub := reg.FindStringSubmatchIndex(match)
+			if sub[2] < 0 {
+				return match
+			}
+			return match[:sub[2]] + r.secret(match[sub[2]:sub[3]]) + match[sub[3]:]
+		})
+	}
+	return value
+}
+
+// matchKey returns true if a variable or flag name matches one of the key patterns
+func (r *redactor) matchKey(key string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range r.keys {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// secret returns the replacement of a secret
+func (r *redactor) secret(value string) string {
+	if strings.HasPrefix(value, redactedPlaceholder[:len(redactedPlaceholder)-1]) {
+		// already redacted
+		return value
+	}
+	if !r.hash {
+		return redactedPlaceholder
+	}
+	sum := sha256.Sum256([]byte(r.salt + value))
+	return "[REDACTED:" + hex.EncodeToString(sum[:8]) + "]"
+}
@@ -0,0 +1,205 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build freebsd || linux
+// +build freebsd linux
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// capabilityNames are the names of the capability bits, see capability(7)
+var capabilityNames = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_DAC_READ_SEARCH",
+	"CAP_FOWNER",
+	"CAP_FSETID",
+	"CAP_KILL",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETPCAP",
+	"CAP_LINUX_IMMUTABLE",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN",
+	"CAP_NET_RAW",
+	"CAP_IPC_LOCK",
+	"CAP_IPC_OWNER",
+	"CAP_SYS_MODULE",
+	"CAP_SYS_RAWIO",
+	"CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT",
+	"CAP_SYS_ADMIN",
+	"CAP_SYS_BOOT",
+	"CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME",
+	"CAP_SYS_TTY_CONFIG",
+	"CAP_MKNOD",
+	"CAP_LEASE",
+	"CAP_AUDIT_WRITE",
+	"CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP",
+	"CAP_MAC_OVERRIDE",
+	"CAP_MAC_ADMIN",
+	"CAP_SYSLOG",
+	"CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ",
+	"CAP_PERFMON",
+	"CAP_BPF",
+	"CAP_CHECKPOINT_RESTORE",
+}
+
+// seccompModes maps the Seccomp field of /proc/[PID]/status to the mode names
+var seccompModes = map[string]string{
+	"0": "disabled",
+	"1": "strict",
+	"2": "filter",
+}
+
+// getSecurity builds the security context of a process from its parsed /proc/[PID]/status file
+// and its LSM label from /proc/[PID]/attr/current.
+func getSecurity(hostfs resolve.Resolver, pid int, status map[string]string) (ProcSecurity, error) {
+	security := ProcSecurity{}
+	var err error
+
+	security.UID, err = parseStatusIDs(status["Uid"])
+	if err != nil {
+		return security, fmt.Errorf("error parsing Uid: %w", err)
+	}
+	security.GID, err = parseStatusIDs(status["Gid"])
+	if err != nil {
+		return security, fmt.Errorf("error parsing Gid: %w", err)
+	}
+
+	users := getUserDB(hostfs)
+	for _, group := range strings.Fields(status["Groups"]) {
+		gid, err := strconv.Atoi(group)
+		if err != nil {
+			return security, fmt.Errorf("error parsing supplementary group %s: %w", group, err)
+		}
+		security.Groups = append(security.Groups, gid)
+		security.GroupNames = append(security.GroupNames, users.groupName(group))
+	}
+
+	for key, dst := range map[string]*[]string{
+		"CapEff": &security.Capabilities.Effective,
+		"CapPrm": &security.Capabilities.Permitted,
+		"CapBnd": &security.Capabilities.Bounding,
+	} {
+		value, ok := status[key]
+		if !ok {
+			continue
+		}
+		*dst, err = decodeCapabilities(value)
+		if err != nil {
+			return security, fmt.Errorf("error parsing %s: %w", key, err)
+		}
+	}
+
+	if mode, ok := status["Seccomp"]; ok {
+		if name, ok := seccompModes[mode]; ok {
+			security.Seccomp = name
+		} else {
+			security.Seccomp = mode
+		}
+	}
+	security.NoNewPrivs = status["NoNewPrivs"] == "1"
+
+	security.Label, err = getSecurityLabel(hostfs, pid)
+	if err != nil {
+		return security, fmt.Errorf("error getting security label: %w", err)
+	}
+
+	return security, nil
+}
+
+// parseStatusIDs parses the real, effective, saved and filesystem IDs from the Uid or Gid line of /proc/[PID]/status
+func parseStatusIDs(value string) (ProcSecurityIDs, error) {
+	ids := ProcSecurityIDs{}
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ids, nil
+	}
+	if len(fields) != 4 {
+		return ids, fmt.Errorf("expected 4 IDs, got '%s'", value)
+	}
+
+	parsed := make([]int, len(fields))
+	for i, field := range fields {
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return ids, fmt.Errorf("error parsing ID %s: %w", field, err)
+		}
+		parsed[i] = id
+	}
+
+	ids.Real = opt.IntWith(parsed[0])
+	ids.Effective = opt.IntWith(parsed[1])
+	ids.Saved = opt.IntWith(parsed[2])
+	ids.FS = opt.IntWith(parsed[3])
+	return ids, nil
+}
+
+// decodeCapabilities returns the names of the capabilities set in a hex capability mask.
+// Bits that are newer than this list are reported by number.
+func decodeCapabilities(mask string) ([]string, error) {
+	bits, err := strconv.ParseUint(mask, 16, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for i := 0; i < 64; i++ {
+		if bits&(1<<uint(i)) == 0 {
+			continue
+		}
+		if i < len(capabilityNames) {
+			names = append(names, capabilityNames[i])
+		} else {
+			names = append(names, "CAP_"+strconv.Itoa(i))
+		}
+	}
+	return names, nil
+}
+
+// getSecurityLabel reads the SELinux context or AppArmor profile of a process.
+// The label is empty if no LSM is active or the file can't be read.
+func getSecurityLabel(hostfs resolve.Resolver, pid int) (string, error) {
+	path := hostfs.Join("proc", strconv.Itoa(pid), "attr", "current")
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EINVAL) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("error opening file %s: %w", path, err)
+	}
+	return strings.TrimRight(string(data), "\x00\n"), nil
+}
@@ -0,0 +1,128 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build freebsd || linux
+// +build freebsd linux
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// auditUnset is the value of loginuid and sessionid for processes that weren't started from a login session
+const auditUnset = 4294967295
+
+// getSession builds the session of a process from the session and tty_nr fields of /proc/[PID]/stat.
+// Kernel threads have no session.
+func getSession(pid int, sid int, ttyNr uint64) ProcSession {
+	if sid == 0 {
+		return ProcSession{}
+	}
+	session := ProcSession{
+		ID:     opt.IntWith(sid),
+		Leader: sid == pid,
+	}
+	if ttyNr != 0 {
+		session.TTY = decodeTTY(ttyNr)
+	}
+	return session
+}
+
+// decodeTTY decodes a device number from tty_nr into the device name of the terminal, see devices.txt in the kernel docs.
+// The name is left empty for terminals that aren't known by their major number, see getCharDeviceName.
+func decodeTTY(ttyNr uint64) ProcTTY {
+	major := int((ttyNr >> 8) & 0xfff)
+	minor := int((ttyNr & 0xff) | ((ttyNr >> 12) & 0xfff00))
+	tty := ProcTTY{Major: opt.IntWith(major), Minor: opt.IntWith(minor)}
+
+	switch {
+	case major >= 136 && major <= 143:
+		tty.Name = fmt.Sprintf("pts/%d", (major-136)*256+minor)
+	case major == 4 && minor < 64:
+		tty.Name = fmt.Sprintf("tty%d", minor)
+	case major == 4:
+		tty.Name = fmt.Sprintf("ttyS%d", minor-64)
+	case major == 5 && minor == 1:
+		tty.Name = "console"
+	}
+	return tty
+}
+
+// getCharDeviceName returns the DEVNAME of a character device from its uevent file in sysfs, or an empty string if it's unknown.
+func getCharDeviceName(hostfs resolve.Resolver, major, minor int) string {
+	data, err := ioutil.ReadFile(hostfs.Join("sys", "dev", "char", fmt.Sprintf("%d:%d", major, minor), "uevent"))
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if name := strings.TrimPrefix(scanner.Text(), "DEVNAME="); name != scanner.Text() {
+			return name
+		}
+	}
+	return ""
+}
+
+// getAudit reads the audit login UID and session ID of a process.
+// Both are unset for processes that weren't started from a login session, and the files don't exist if the kernel was built without audit support.
+func getAudit(hostfs resolve.Resolver, pid int) (ProcAudit, error) {
+	audit := ProcAudit{}
+
+	loginUID, err := readAuditID(hostfs, pid, "loginuid")
+	if err != nil {
+		return audit, err
+	}
+	if loginUID.Exists() {
+		uid := int(loginUID.ValueOr(0))
+		audit.LoginUID = opt.IntWith(uid)
+		audit.LoginUser = getUserDB(hostfs).userName(strconv.Itoa(uid))
+	}
+
+	audit.SessionID, err = readAuditID(hostfs, pid, "sessionid")
+	return audit, err
+}
+
+// readAuditID reads an ID from a file in /proc/[PID], the ID is none if it's unset or the file doesn't exist.
+func readAuditID(hostfs resolve.Resolver, pid int, name string) (opt.Uint, error) {
+	path := hostfs.Join("proc", strconv.Itoa(pid), name)
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return opt.NewUintNone(), nil
+	} else if err != nil {
+		return opt.NewUintNone(), fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return opt.NewUintNone(), fmt.Errorf("error parsing %s: %w", path, ErrParse)
+	}
+	if id == auditUnset {
+		return opt.NewUintNone(), nil
+	}
+	return opt.UintWith(id), nil
+}
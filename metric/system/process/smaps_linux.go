@@ -0,0 +1,158 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getSmapsData fills out the PSS, USS and swap metrics of a process from /proc/[PID]/smaps_rollup.
+// On kernels older than 4.14, which lack smaps_rollup, the values of every mapping in /proc/[PID]/smaps are summed instead.
+// Reading either file requires ptrace access to the process, so permission errors are ignored.
+func getSmapsData(hostfs resolve.Resolver, pid int, mem ProcMemInfo) (ProcMemInfo, error) {
+	path := hostfs.Join("proc", strconv.Itoa(pid), "smaps_rollup")
+	data, err := ioutil.ReadFile(path)
+	rollup := true
+	if errors.Is(err, os.ErrNotExist) {
+		path = hostfs.Join("proc", strconv.Itoa(pid), "smaps")
+		data, err = ioutil.ReadFile(path)
+		rollup = false
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return mem, nil
+	} else if err != nil {
+		return mem, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+
+	values, err := parseSmaps(data)
+	if err != nil {
+		return mem, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	// kernel threads have no mappings
+	if _, ok := values["Rss"]; !ok {
+		return mem, nil
+	}
+
+	mem.Pss = opt.UintWith(values["Pss"])
+	mem.Uss = opt.UintWith(values["Private_Clean"] + values["Private_Dirty"])
+	mem.Swap = opt.UintWith(values["Swap"])
+	mem.SwapPss = opt.UintWith(values["SwapPss"])
+	mem.Anonymous = opt.UintWith(values["Anonymous"])
+	// Pss_File is only reported by smaps_rollup on kernel 5.8 and newer.
+	// Rss minus Anonymous isn't used as a fallback, as that would also count shmem and tmpfs pages,
+	// instead the file-backed mappings are summed from smaps, which has to be read on kernels from 4.14 to 5.7.
+	if pssFile, ok := values["Pss_File"]; ok {
+		mem.FileBacked = opt.UintWith(pssFile)
+		return mem, nil
+	}
+	if rollup {
+		path = hostfs.Join("proc", strconv.Itoa(pid), "smaps")
+		data, err = ioutil.ReadFile(path)
+		if err != nil {
+			return mem, fmt.Errorf("error opening file %s: %w", path, err)
+		}
+	}
+	pssFile, err := sumFilePss(data)
+	if err != nil {
+		return mem, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	mem.FileBacked = opt.UintWith(pssFile)
+
+	return mem, nil
+}
+
+// parseSmaps sums the size fields of a smaps or smaps_rollup file, and returns them in bytes.
+func parseSmaps(data []byte) (map[string]uint64, error) {
+	values := map[string]uint64{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		// size lines look like `Pss:                 506 kB`,
+		// everything else is either a mapping header or a non-size field like VmFlags
+		fields := bytes.Fields(line)
+		if len(fields) != 3 || !bytes.Equal(fields[2], []byte("kB")) || !bytes.HasSuffix(fields[0], []byte(":")) {
+			continue
+		}
+
+		value, err := strconv.ParseUint(string(fields[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing value of %s: %w", fields[0], err)
+		}
+		values[string(fields[0][:len(fields[0])-1])] += value * 1024
+	}
+	return values, nil
+}
+
+// sumFilePss sums the PSS of the file-backed mappings of a smaps file, in bytes, which is what Pss_File reports in smaps_rollup.
+// Private file mappings can hold anonymous copy-on-write pages, which are left out.
+func sumFilePss(data []byte) (uint64, error) {
+	var total, pss, anonymous uint64
+	isFile := false
+	addMapping := func() {
+		if isFile && pss > anonymous {
+			total += pss - anonymous
+		}
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if !bytes.HasSuffix(fields[0], []byte(":")) {
+			addMapping()
+			mapping, err := parseMappingHeader(string(line))
+			if err != nil {
+				return 0, err
+			}
+			isFile = mapping.Kind == "file"
+			pss, anonymous = 0, 0
+			continue
+		}
+		if len(fields) != 3 || !bytes.Equal(fields[2], []byte("kB")) {
+			continue
+		}
+
+		var dst *uint64
+		switch string(fields[0]) {
+		case "Pss:":
+			dst = &pss
+		case "Anonymous:":
+			dst = &anonymous
+		default:
+			continue
+		}
+		value, err := strconv.ParseUint(string(fields[1]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("error parsing value of %s: %w", fields[0], err)
+		}
+		*dst = value * 1024
+	}
+	addMapping()
+	return total, nil
+}
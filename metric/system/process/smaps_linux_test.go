@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetSmapsRollup(t *testing.T) {
+	mem, err := getSmapsData(resolve.NewTestResolver("./testdata"), 1234, ProcMemInfo{})
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(506*1024), mem.Pss.ValueOr(0))
+	assert.Equal(t, uint64(176*1024), mem.Uss.ValueOr(0))
+	assert.Equal(t, uint64(64*1024), mem.Swap.ValueOr(0))
+	assert.Equal(t, uint64(32*1024), mem.SwapPss.ValueOr(0))
+	assert.Equal(t, uint64(100*1024), mem.Anonymous.ValueOr(0))
+	// Pss_File, which doesn't include shmem
+	assert.Equal(t, uint64(406*1024), mem.FileBacked.ValueOr(0))
+}
+
+func TestGetSmapsFallback(t *testing.T) {
+	// pid 1235 has no smaps_rollup, only smaps
+	mem, err := getSmapsData(resolve.NewTestResolver("./testdata"), 1235, ProcMemInfo{})
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(20*1024), mem.Pss.ValueOr(0))
+	assert.Equal(t, uint64(20*1024), mem.Uss.ValueOr(0))
+	assert.Equal(t, uint64(4*1024), mem.Swap.ValueOr(0))
+	assert.Equal(t, uint64(12*1024), mem.Anonymous.ValueOr(0))
+	// only the /usr/bin/head mapping, the heap is anonymous
+	assert.Equal(t, uint64(8*1024), mem.FileBacked.ValueOr(0))
+}
+
+func TestGetSmapsRollupWithoutPssFile(t *testing.T) {
+	// kernels from 4.14 to 5.7 have smaps_rollup, but no Pss_File
+	rollup, err := os.ReadFile("./testdata/proc/1234/smaps_rollup")
+	require.NoError(t, err)
+	smaps, err := os.ReadFile("./testdata/proc/1235/smaps")
+	require.NoError(t, err)
+	var lines []string
+	for _, line := range strings.Split(string(rollup), "\n") {
+		if !strings.HasPrefix(line, "Pss_") {
+			lines = append(lines, line)
+		}
+	}
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "proc", "1234"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1234", "smaps_rollup"), []byte(strings.Join(lines, "\n")), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1234", "smaps"), smaps, 0o644))
+
+	mem, err := getSmapsData(resolve.NewTestResolver(root), 1234, ProcMemInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(506*1024), mem.Pss.ValueOr(0))
+	assert.Equal(t, uint64(8*1024), mem.FileBacked.ValueOr(0))
+}
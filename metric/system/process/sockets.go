@@ -0,0 +1,62 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import "sync"
+
+// socketTables holds the parsed /proc/net socket tables of one network namespace, by socket inode
+type socketTables struct {
+	inet map[uint64]inetSocket
+	unix map[uint64]struct{}
+}
+
+// inetSocket is an entry of the /proc/net/{tcp,tcp6,udp,udp6} tables
+type inetSocket struct {
+	local  ProcSocketAddr
+	remote ProcSocketAddr
+	// state is the TCP state, or empty for UDP sockets
+	state string
+}
+
+// socketCache shares the parsed socket tables between the processes in the same network namespace during a fetch cycle.
+type socketCache struct {
+	mut    sync.Mutex
+	tables map[uint64]*socketTables
+}
+
+func newSocketCache() *socketCache {
+	return &socketCache{tables: make(map[uint64]*socketTables)}
+}
+
+// get returns the tables of a network namespace, and loads them the first time the namespace is seen.
+func (c *socketCache) get(netns uint64, load func() (*socketTables, error)) (*socketTables, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if tables, ok := c.tables[netns]; ok {
+		return tables, nil
+	}
+	tables, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.tables[netns] = tables
+	return tables, nil
+}
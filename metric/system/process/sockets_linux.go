@@ -0,0 +1,294 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// tcpStates maps the hex states of /proc/net/tcp to their names, see include/net/tcp_states.h
+var tcpStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+	"0C": "new_syn_recv",
+}
+
+// nativeEndian is the byte order the kernel uses for the addresses in /proc/net/{tcp,udp}
+var nativeEndian = func() binary.ByteOrder {
+	buf := [2]byte{}
+	*(*uint16)(unsafe.Pointer(&buf[0])) = 0x0102
+	if buf[0] == 0x01 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}()
+
+// getSockets matches the socket FDs of a process against the socket tables of its network namespace.
+// If cache is set, the tables are only parsed once per namespace.
+// Reading the FDs of another user's process requires privileges, so permission errors are ignored.
+func getSockets(hostfs resolve.Resolver, pid int, cache *socketCache, remote bool) (ProcSockets, error) {
+	sockets := ProcSockets{}
+
+	inodes, err := getSocketInodes(hostfs, pid)
+	if errors.Is(err, os.ErrPermission) {
+		return sockets, nil
+	} else if err != nil {
+		return sockets, err
+	}
+	if len(inodes) == 0 {
+		return sockets, nil
+	}
+
+	load := func() (*socketTables, error) { return readSocketTables(hostfs, pid) }
+	var tables *socketTables
+	netns, nsErr := getNetNamespace(hostfs, pid)
+	if cache != nil && nsErr == nil {
+		tables, err = cache.get(netns, load)
+	} else {
+		tables, err = load()
+	}
+	if err != nil {
+		return sockets, fmt.Errorf("error reading socket tables for pid %d: %w", pid, err)
+	}
+
+	listening := map[ProcSocketAddr]struct{}{}
+	for _, inode := range inodes {
+		if _, ok := tables.unix[inode]; ok {
+			sockets.Unix = opt.IntWith(sockets.Unix.ValueOr(0) + 1)
+			continue
+		}
+		socket, ok := tables.inet[inode]
+		if !ok {
+			continue
+		}
+
+		isTCP := strings.HasPrefix(socket.local.Protocol, "tcp")
+		switch {
+		case isTCP && socket.state == "listen":
+			listening[socket.local] = struct{}{}
+			continue
+		case isTCP:
+			if sockets.Connections == nil {
+				sockets.Connections = map[string]int{}
+			}
+			sockets.Connections[socket.state]++
+		case socket.remote.Port == 0:
+			// unconnected UDP sockets receive from anyone
+			sockets.UDP = opt.IntWith(sockets.UDP.ValueOr(0) + 1)
+			listening[socket.local] = struct{}{}
+			continue
+		default:
+			sockets.UDP = opt.IntWith(sockets.UDP.ValueOr(0) + 1)
+		}
+
+		if remote && socket.remote.Port != 0 {
+			sockets.Remote = append(sockets.Remote, socket.remote)
+		}
+	}
+
+	for addr := range listening {
+		sockets.Listening = append(sockets.Listening, addr)
+	}
+	sortSocketAddrs(sockets.Listening)
+	sortSocketAddrs(sockets.Remote)
+
+	return sockets, nil
+}
+
+// getSocketInodes returns the inodes of the sockets in /proc/[PID]/fd, which are linked as "socket:[inode]"
+func getSocketInodes(hostfs resolve.Resolver, pid int) ([]uint64, error) {
+	path := hostfs.Join("proc", strconv.Itoa(pid), "fd")
+	fds, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading FD directory %s: %w", path, err)
+	}
+
+	inodes := []uint64{}
+	for _, fd := range fds {
+		link, err := os.Readlink(hostfs.Join("proc", strconv.Itoa(pid), "fd", fd.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+			// the FD was closed in the meantime, or isn't a socket
+			continue
+		}
+		inode, err := strconv.ParseUint(link[len("socket:["):len(link)-1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing socket inode from '%s': %w", link, err)
+		}
+		inodes = append(inodes, inode)
+	}
+	return inodes, nil
+}
+
+// getNetNamespace returns the inode of the network namespace of a process
+func getNetNamespace(hostfs resolve.Resolver, pid int) (uint64, error) {
+	link, err := os.Readlink(hostfs.Join("proc", strconv.Itoa(pid), "ns", "net"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "net:["), "]"), 10, 64)
+}
+
+// readSocketTables parses the socket tables in /proc/[PID]/net, which show the network namespace of the process.
+// Tables that are missing because a protocol is disabled are skipped.
+func readSocketTables(hostfs resolve.Resolver, pid int) (*socketTables, error) {
+	tables := &socketTables{inet: map[uint64]inetSocket{}, unix: map[uint64]struct{}{}}
+
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		err := readNetTable(hostfs.Join("proc", strconv.Itoa(pid), "net", proto), func(fields []string) error {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			if len(fields) < 10 {
+				return fmt.Errorf("expected 10 fields, got %d", len(fields))
+			}
+			socket := inetSocket{}
+			var err error
+			if socket.local, err = parseSocketAddr(proto, fields[1]); err != nil {
+				return err
+			}
+			if socket.remote, err = parseSocketAddr(proto, fields[2]); err != nil {
+				return err
+			}
+			if strings.HasPrefix(proto, "tcp") {
+				socket.state = tcpStates[fields[3]]
+				if socket.state == "" {
+					socket.state = strings.ToLower(fields[3])
+				}
+			}
+			inode, err := strconv.ParseUint(fields[9], 10, 64)
+			if err != nil {
+				return fmt.Errorf("error parsing inode %s: %w", fields[9], err)
+			}
+			tables.inet[inode] = socket
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := readNetTable(hostfs.Join("proc", strconv.Itoa(pid), "net", "unix"), func(fields []string) error {
+		// Num RefCount Protocol Flags Type St Inode Path
+		if len(fields) < 7 {
+			return fmt.Errorf("expected 7 fields, got %d", len(fields))
+		}
+		inode, err := strconv.ParseUint(fields[6], 10, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing inode %s: %w", fields[6], err)
+		}
+		tables.unix[inode] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tables, nil
+}
+
+// readNetTable calls parse with the fields of every entry of a /proc/net table, skipping the header.
+func readNetTable(path string, parse func(fields []string) error) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error opening file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := parse(fields); err != nil {
+			return fmt.Errorf("error parsing line '%s' of %s: %w", scanner.Text(), path, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	return nil
+}
+
+// parseSocketAddr parses an address from /proc/net/{tcp,udp}, e.g. "0100007F:0CEA".
+// The IP is printed as 32-bit words in host byte order, and the port in hex.
+func parseSocketAddr(proto, value string) (ProcSocketAddr, error) {
+	addr := ProcSocketAddr{Protocol: proto}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return addr, fmt.Errorf("malformed address '%s'", value)
+	}
+
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return addr, fmt.Errorf("malformed IP '%s'", parts[0])
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], nativeEndian.Uint32(raw[i:]))
+	}
+	addr.IP = ip.String()
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return addr, fmt.Errorf("malformed port '%s': %w", parts[1], err)
+	}
+	addr.Port = int(port)
+
+	return addr, nil
+}
+
+// sortSocketAddrs sorts addresses by protocol, port and IP, so events are stable between cycles
+func sortSocketAddrs(addrs []ProcSocketAddr) {
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].Protocol != addrs[j].Protocol {
+			return addrs[i].Protocol < addrs[j].Protocol
+		}
+		if addrs[i].Port != addrs[j].Port {
+			return addrs[i].Port < addrs[j].Port
+		}
+		return addrs[i].IP < addrs[j].IP
+	})
+}
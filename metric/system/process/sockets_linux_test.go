@@ -0,0 +1,159 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+const (
+	testTCPTable = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 100 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0CEA 0200007F:D431 01 00000000:00000000 00:00000000 00000000   999        0 101 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:0CEA 0300007F:D432 01 00000000:00000000 00:00000000 00000000   999        0 105 1 0000000000000000 20 4 30 10 -1
+   3: 0100007F:0CEA 0400007F:D433 06 00000000:00000000 00:00000000 00000000   999        0 106 1 0000000000000000 20 4 30 10 -1
+`
+	testTCP6Table = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:1F90 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 103 1 0000000000000000 100 0 0 10 0
+`
+	testUDPTable = `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  10: 00000000:0044 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 102 2 0000000000000000 0
+`
+	testUnixTable = `Num       RefCount Protocol Flags    Type St Inode Path
+0000000000000000: 00000002 00000000 00010000 0001 01 104 /run/test.sock
+`
+)
+
+// writeSocketProcfs creates a process with socket FDs in a fake procfs, and returns its root
+func writeSocketProcfs(t *testing.T, netTables bool) string {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "proc", "42")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "fd"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "ns"), 0o755))
+	require.NoError(t, os.Symlink("net:[4026531992]", filepath.Join(dir, "ns", "net")))
+	for i, inode := range []int{100, 101, 102, 103, 104, 106} {
+		require.NoError(t, os.Symlink("socket:["+strconv.Itoa(inode)+"]", filepath.Join(dir, "fd", strconv.Itoa(i+3))))
+	}
+	require.NoError(t, os.Symlink("/dev/null", filepath.Join(dir, "fd", "0")))
+
+	if netTables {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "net"), 0o755))
+		for name, content := range map[string]string{"tcp": testTCPTable, "tcp6": testTCP6Table, "udp": testUDPTable, "unix": testUnixTable} {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "net", name), []byte(content), 0o644))
+		}
+	}
+	return root
+}
+
+func TestParseSocketAddr(t *testing.T) {
+	if nativeEndian != binary.LittleEndian {
+		t.Skip("test addresses are in little endian")
+	}
+
+	addr, err := parseSocketAddr("tcp", "0100007F:0CEA")
+	require.NoError(t, err)
+	assert.Equal(t, ProcSocketAddr{Protocol: "tcp", IP: "127.0.0.1", Port: 3306}, addr)
+
+	addr, err = parseSocketAddr("tcp6", "00000000000000000000000001000000:1F90")
+	require.NoError(t, err)
+	assert.Equal(t, ProcSocketAddr{Protocol: "tcp6", IP: "::1", Port: 8080}, addr)
+
+	_, err = parseSocketAddr("tcp", "0100007F")
+	assert.Error(t, err)
+	_, err = parseSocketAddr("tcp", "01007F:0CEA")
+	assert.Error(t, err)
+}
+
+func TestGetSockets(t *testing.T) {
+	if nativeEndian != binary.LittleEndian {
+		t.Skip("test addresses are in little endian")
+	}
+	hostfs := resolve.NewTestResolver(writeSocketProcfs(t, true))
+
+	sockets, err := getSockets(hostfs, 42, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, []ProcSocketAddr{
+		{Protocol: "tcp", IP: "127.0.0.1", Port: 3306},
+		{Protocol: "tcp6", IP: "::", Port: 8080},
+		{Protocol: "udp", IP: "0.0.0.0", Port: 68},
+	}, sockets.Listening)
+	// the connection with inode 105 belongs to another process
+	assert.Equal(t, map[string]int{"established": 1, "time_wait": 1}, sockets.Connections)
+	assert.Equal(t, 1, sockets.UDP.ValueOr(0))
+	assert.Equal(t, 1, sockets.Unix.ValueOr(0))
+	assert.Empty(t, sockets.Remote)
+
+	sockets, err = getSockets(hostfs, 42, nil, true)
+	require.NoError(t, err)
+	assert.Equal(t, []ProcSocketAddr{
+		{Protocol: "tcp", IP: "127.0.0.2", Port: 54321},
+		{Protocol: "tcp", IP: "127.0.0.4", Port: 54323},
+	}, sockets.Remote)
+}
+
+func TestGetSocketsCache(t *testing.T) {
+	cache := newSocketCache()
+	sockets, err := getSockets(resolve.NewTestResolver(writeSocketProcfs(t, true)), 42, cache, false)
+	require.NoError(t, err)
+	require.Len(t, sockets.Listening, 3)
+
+	// a process in the same namespace reuses the parsed tables
+	sockets, err = getSockets(resolve.NewTestResolver(writeSocketProcfs(t, false)), 42, cache, false)
+	require.NoError(t, err)
+	assert.Len(t, sockets.Listening, 3)
+	assert.Len(t, cache.tables, 1)
+
+	// no tables without a cache
+	sockets, err = getSockets(resolve.NewTestResolver(writeSocketProcfs(t, false)), 42, nil, false)
+	require.NoError(t, err)
+	assert.True(t, sockets.IsZero())
+}
+
+func TestGetOneSockets(t *testing.T) {
+	testConfig := Stats{
+		Procs:         []string{".*"},
+		Hostfs:        resolve.NewTestResolver("/"),
+		EnableSockets: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	pidData, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	listening, err := pidData.GetValue("sockets.listening")
+	require.NoError(t, err)
+	assert.Contains(t, listening, map[string]interface{}{"protocol": "tcp", "ip": "127.0.0.1", "port": int64(port)})
+}
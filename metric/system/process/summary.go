@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"fmt"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// ProcSummary is a host-level summary of the processes in each state
+type ProcSummary struct {
+	Total     int `struct:"total"`
+	Running   int `struct:"running"`
+	Sleeping  int `struct:"sleeping"`
+	DiskSleep int `struct:"disk_sleep"`
+	Zombie    int `struct:"zombie"`
+	Stopped   int `struct:"stopped"`
+	Idle      int `struct:"idle"`
+	Dead      int `struct:"dead"`
+	// Unknown also counts the states that only exist on some kernels, such as wakekill, waking and parked
+	Unknown int `struct:"unknown"`
+
+	// Threads is the total number of threads of all processes, where the OS reports it
+	Threads opt.Int `struct:"threads,omitempty"`
+	// PidMax and ThreadsMax are the limits from /proc/sys/kernel/pid_max and /proc/sys/kernel/threads-max. Linux only.
+	PidMax     opt.Int `struct:"pid_max,omitempty"`
+	ThreadsMax opt.Int `struct:"threads_max,omitempty"`
+	// PidPct is the fraction of PidMax in use. Every thread uses a PID, so this is based on the thread count if it's known.
+	PidPct opt.Float `struct:"pid_pct,omitempty"`
+	// ThreadsPct is the fraction of ThreadsMax in use
+	ThreadsPct opt.Float `struct:"threads_pct,omitempty"`
+}
+
+// summarizeStates counts the given processes by state and adds the host PID and thread limits.
+func summarizeStates(hostfs resolve.Resolver, procs []ProcState) (ProcSummary, error) {
+	var err error
+	summary := ProcSummary{}
+	for _, proc := range procs {
+		summary.Total++
+		switch proc.State {
+		case Running:
+			summary.Running++
+		case Sleeping:
+			summary.Sleeping++
+		case DiskSleep:
+			summary.DiskSleep++
+		case Zombie:
+			summary.Zombie++
+		case Stopped:
+			summary.Stopped++
+		case Idle:
+			summary.Idle++
+		case Dead:
+			summary.Dead++
+		default:
+			summary.Unknown++
+		}
+		// num_threads in /proc/[PID]/stat is the same counter as Threads in /proc/[PID]/status
+		if proc.NumThreads.Exists() {
+			summary.Threads = opt.IntWith(summary.Threads.ValueOr(0) + proc.NumThreads.ValueOr(0))
+		}
+	}
+
+	summary.PidMax, summary.ThreadsMax, err = getPidLimits(hostfs)
+	if err != nil {
+		return summary, fmt.Errorf("error fetching PID limits: %w", err)
+	}
+	if pidMax := summary.PidMax.ValueOr(0); pidMax > 0 {
+		used := summary.Total
+		if summary.Threads.Exists() {
+			used = summary.Threads.ValueOr(0)
+		}
+		summary.PidPct = opt.FloatWith(metric.Round(float64(used) / float64(pidMax)))
+	}
+	if threadsMax := summary.ThreadsMax.ValueOr(0); threadsMax > 0 && summary.Threads.Exists() {
+		summary.ThreadsPct = opt.FloatWith(metric.Round(float64(summary.Threads.ValueOr(0)) / float64(threadsMax)))
+	}
+
+	return summary, nil
+}
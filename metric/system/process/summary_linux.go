@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getPidLimits reads the maximum PID and number of threads from /proc/sys/kernel
+func getPidLimits(hostfs resolve.Resolver) (opt.Int, opt.Int, error) {
+	pidMax, err := readSysctlInt(hostfs, "kernel", "pid_max")
+	if err != nil {
+		return opt.NewIntNone(), opt.NewIntNone(), err
+	}
+	threadsMax, err := readSysctlInt(hostfs, "kernel", "threads-max")
+	if err != nil {
+		return opt.NewIntNone(), opt.NewIntNone(), err
+	}
+	return pidMax, threadsMax, nil
+}
+
+// readSysctlInt reads an integer from a file under /proc/sys
+func readSysctlInt(hostfs resolve.Resolver, name ...string) (opt.Int, error) {
+	path := hostfs.Join(append([]string{"proc", "sys"}, name...)...)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return opt.NewIntNone(), fmt.Errorf("error reading %s: %w", path, err)
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return opt.NewIntNone(), fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return opt.IntWith(value), nil
+}
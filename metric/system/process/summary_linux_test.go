@@ -0,0 +1,71 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestSummary(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 4)
+	// worker-3 is a zombie, worker-4 is running
+	for pid, state := range map[string]string{"1003": "Z", "1004": "R"} {
+		path := filepath.Join(root, "proc", pid, "stat")
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), ") S ", ") "+state+" ", 1)), 0o644))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "proc", "sys", "kernel"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "sys", "kernel", "pid_max"), []byte("32768\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "sys", "kernel", "threads-max"), []byte("8\n"), 0o644))
+
+	summary, err := Summary(resolve.NewTestResolver(root))
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, summary.Total)
+	assert.Equal(t, 2, summary.Sleeping)
+	assert.Equal(t, 1, summary.Zombie)
+	assert.Equal(t, 1, summary.Running)
+	assert.Equal(t, 0, summary.Unknown)
+	// every synthetic process has a single thread
+	assert.Equal(t, 4, summary.Threads.ValueOr(0))
+	assert.Equal(t, 32768, summary.PidMax.ValueOr(0))
+	assert.Equal(t, 8, summary.ThreadsMax.ValueOr(0))
+	assert.Equal(t, 0.0001, summary.PidPct.ValueOr(0))
+	assert.Equal(t, 0.5, summary.ThreadsPct.ValueOr(0))
+}
+
+func TestSummarySelf(t *testing.T) {
+	summary, err := Summary(resolve.NewTestResolver("/"))
+	require.NoError(t, err)
+	assert.NotZero(t, summary.Total)
+	assert.GreaterOrEqual(t, summary.Threads.ValueOr(0), summary.Total)
+	assert.True(t, summary.PidMax.Exists())
+}
@@ -0,0 +1,99 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"syscall"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getThreadData fetches the state and CPU times for every thread of a process from /proc/[PID]/task
+func getThreadData(hostfs resolve.Resolver, pid int) ([]ThreadState, error) {
+	path := hostfs.Join("proc", strconv.Itoa(pid), "task")
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening task directory %s: %w", path, err)
+	}
+	defer dir.Close()
+
+	const readAllDirnames = -1 // see os.File.Readdirnames doc
+
+	names, err := dir.Readdirnames(readAllDirnames)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory names from %s: %w", path, err)
+	}
+
+	threads := make([]ThreadState, 0, len(names))
+	for _, name := range names {
+		if !dirIsPid(name) {
+			continue
+		}
+		tid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+
+		statPath := hostfs.Join("proc", strconv.Itoa(pid), "task", name, "stat")
+		info, err := getInfoFromStat(hostfs, statPath, tid)
+		// threads can exit between reading the task directory and reading their stat file
+		if isThreadGone(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("error fetching info for thread %d of pid %d: %w", tid, pid, err)
+		}
+
+		cpu, err := getCPUTimeFromStat(hostfs, statPath, tid)
+		if isThreadGone(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("error fetching CPU data for thread %d of pid %d: %w", tid, pid, err)
+		}
+		if cpu.Total.Ticks.Exists() {
+			cpu.Total.Value = opt.FloatWith(metric.Round(float64(cpu.Total.Ticks.ValueOr(0))))
+		}
+
+		threads = append(threads, ThreadState{
+			Tid:   opt.IntWith(tid),
+			Name:  info.Name,
+			State: info.State,
+			CPU:   cpu,
+		})
+	}
+
+	sort.Slice(threads, func(i, j int) bool {
+		return threads[i].Tid.ValueOr(0) < threads[j].Tid.ValueOr(0)
+	})
+
+	return threads, nil
+}
+
+// isThreadGone returns true if a read from /proc/[PID]/task/[TID] failed because the thread exited
+func isThreadGone(err error) bool {
+	return errors.Is(err, syscall.ESRCH) || errors.Is(err, os.ErrNotExist)
+}
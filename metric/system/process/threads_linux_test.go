@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetThreadData(t *testing.T) {
+	threads, err := getThreadData(resolve.NewTestResolver("./testdata"), 1234)
+	require.NoError(t, err)
+	require.Len(t, threads, 2)
+
+	assert.Equal(t, 1234, threads[0].Tid.ValueOr(0))
+	assert.Equal(t, "java", threads[0].Name)
+	assert.Equal(t, Sleeping, threads[0].State)
+	assert.Equal(t, uint64(1200), threads[0].CPU.Total.Ticks.ValueOr(0))
+
+	assert.Equal(t, 1240, threads[1].Tid.ValueOr(0))
+	// JVM thread names contain spaces
+	assert.Equal(t, "C2 CompilerThre", threads[1].Name)
+	assert.Equal(t, Running, threads[1].State)
+	assert.Equal(t, uint64(500), threads[1].CPU.User.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(100), threads[1].CPU.System.Ticks.ValueOr(0))
+	btime, err := getLinuxBootTime(resolve.NewTestResolver("./testdata"))
+	require.NoError(t, err)
+	assert.Equal(t, unixTimeMsToTime(startTicksToUnixMs(5100, btime)), threads[1].CPU.StartTime)
+}
+
+func TestGetThreadDataExited(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticProcfs(t, root, 1)
+	stat, err := os.ReadFile(filepath.Join(root, "proc", "1001", "stat"))
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "proc", "1001", "task", "1001"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "1001", "task", "1001", "stat"), stat, 0o644))
+	// thread 1002 exited after the task directory was read
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "proc", "1001", "task", "1002"), 0o755))
+
+	threads, err := getThreadData(resolve.NewTestResolver(root), 1001)
+	require.NoError(t, err)
+	require.Len(t, threads, 1)
+	assert.Equal(t, 1001, threads[0].Tid.ValueOr(0))
+}
+
+func TestThreadCPUPercentages(t *testing.T) {
+	now := time.Now()
+	last := ProcState{
+		SampleTime: now,
+		Threads: []ThreadState{
+			{Tid: opt.IntWith(10), CPU: ProcCPUInfo{StartTime: "a", Total: CPUTotal{Ticks: opt.UintWith(1000)}}},
+			{Tid: opt.IntWith(11), CPU: ProcCPUInfo{StartTime: "a", Total: CPUTotal{Ticks: opt.UintWith(1000)}}},
+		},
+	}
+	cur := ProcState{
+		SampleTime: now.Add(time.Second),
+		Threads: []ThreadState{
+			{Tid: opt.IntWith(10), CPU: ProcCPUInfo{StartTime: "a", Total: CPUTotal{Ticks: opt.UintWith(1500)}}},
+			// TID was reused by a new thread
+			{Tid: opt.IntWith(11), CPU: ProcCPUInfo{StartTime: "b", Total: CPUTotal{Ticks: opt.UintWith(10)}}},
+			{Tid: opt.IntWith(12), CPU: ProcCPUInfo{StartTime: "b", Total: CPUTotal{Ticks: opt.UintWith(10)}}},
+		},
+	}
+
+	threads := fillThreadCPUPercentages(last, cur)
+	require.Len(t, threads, 3)
+	assert.Equal(t, 0.5, threads[0].CPU.Total.Pct.ValueOr(0))
+	assert.False(t, threads[1].CPU.Total.Pct.Exists())
+	assert.False(t, threads[2].CPU.Total.Pct.Exists())
+}
+
+func TestThreadsInEvent(t *testing.T) {
+	testConfig := Stats{
+		Procs:         []string{".*"},
+		Hostfs:        resolve.NewTestResolver("/"),
+		EnableThreads: true,
+	}
+	err := testConfig.Init()
+	require.NoError(t, err)
+
+	_, err = testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 5)
+	data, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+
+	threads, ok := data["threads"].([]interface{})
+	require.True(t, ok, "threads not found in event")
+	require.NotEmpty(t, threads)
+
+	time.Sleep(time.Millisecond * 5)
+	selfThreads, err := testConfig.GetThreads(os.Getpid())
+	require.NoError(t, err)
+	require.NotEmpty(t, selfThreads)
+	assert.True(t, selfThreads[0].CPU.Total.Pct.Exists())
+}
@@ -0,0 +1,168 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"sort"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+)
+
+// ProcessTree indexes a snapshot of processes, such as the ProcsMap returned by FetchPids, by their parent PID.
+// Only the processes in the snapshot are part of the tree, so a process whose parent was filtered out is a root.
+type ProcessTree struct {
+	procs    ProcsMap
+	children map[int][]int
+}
+
+// NewProcessTree builds a process tree from the given snapshot
+func NewProcessTree(procs ProcsMap) *ProcessTree {
+	tree := &ProcessTree{
+		procs:    procs,
+		children: make(map[int][]int),
+	}
+	for pid, proc := range procs {
+		ppid := proc.Ppid.ValueOr(pid)
+		if ppid == pid {
+			continue
+		}
+		if _, ok := procs[ppid]; ok {
+			tree.children[ppid] = append(tree.children[ppid], pid)
+		}
+	}
+	for _, children := range tree.children {
+		sort.Ints(children)
+	}
+	return tree
+}
+
+// Process returns the state of a process in the tree
+func (tree *ProcessTree) Process(pid int) (ProcState, bool) {
+	proc, ok := tree.procs[pid]
+	return proc, ok
+}
+
+// Roots returns the processes whose parent is not part of the tree
+func (tree *ProcessTree) Roots() []int {
+	roots := []int{}
+	for pid, proc := range tree.procs {
+		ppid := proc.Ppid.ValueOr(pid)
+		if _, found := tree.procs[ppid]; !found || ppid == pid {
+			roots = append(roots, pid)
+		}
+	}
+	sort.Ints(roots)
+	return roots
+}
+
+// Children returns the direct children of a process
+func (tree *ProcessTree) Children(pid int) []int {
+	return tree.children[pid]
+}
+
+// Ancestors returns the parent chain of a process, starting with its parent and ending at a root of the tree
+func (tree *ProcessTree) Ancestors(pid int) []int {
+	ancestors := []int{}
+	seen := map[int]bool{pid: true}
+	for {
+		proc, ok := tree.procs[pid]
+		if !ok {
+			return ancestors
+		}
+		ppid := proc.Ppid.ValueOr(pid)
+		if _, found := tree.procs[ppid]; !found || seen[ppid] {
+			return ancestors
+		}
+		ancestors = append(ancestors, ppid)
+		seen[ppid] = true
+		pid = ppid
+	}
+}
+
+// Descendants returns all the processes below a process in the tree, sorted by PID
+func (tree *ProcessTree) Descendants(pid int) []int {
+	descendants := []int{}
+	seen := map[int]bool{pid: true}
+	queue := tree.children[pid]
+	for len(queue) > 0 {
+		child := queue[0]
+		queue = queue[1:]
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		descendants = append(descendants, child)
+		queue = append(queue, tree.children[child]...)
+	}
+	sort.Ints(descendants)
+	return descendants
+}
+
+// Subtree returns the resources used by a process and all of its descendants.
+// Metrics are summed over the processes that report them, and are left unset if none does.
+func (tree *ProcessTree) Subtree(pid int) (ProcTreeInfo, bool) {
+	proc, ok := tree.procs[pid]
+	if !ok {
+		return ProcTreeInfo{}, false
+	}
+
+	descendants := tree.Descendants(pid)
+	info := ProcTreeInfo{
+		Children:    opt.IntWith(len(tree.children[pid])),
+		Descendants: opt.IntWith(len(descendants)),
+	}
+
+	addProc := func(proc ProcState) {
+		info.CPU.Pct = addFloat(info.CPU.Pct, proc.CPU.Total.Pct)
+		info.CPU.Norm.Pct = addFloat(info.CPU.Norm.Pct, proc.CPU.Total.Norm.Pct)
+		info.Memory.Rss.Bytes = addUint(info.Memory.Rss.Bytes, proc.Memory.Rss.Bytes)
+		info.FD.Open = addUint(info.FD.Open, proc.FD.Open)
+		threads := proc.NumThreads
+		if !threads.Exists() && len(proc.Threads) > 0 {
+			threads = opt.IntWith(len(proc.Threads))
+		}
+		if threads.Exists() {
+			info.Threads = opt.IntWith(info.Threads.ValueOr(0) + threads.ValueOr(0))
+		}
+	}
+	addProc(proc)
+	for _, child := range descendants {
+		addProc(tree.procs[child])
+	}
+
+	return info, true
+}
+
+// addFloat adds an optional value to a sum, which is unset until a value is added
+func addFloat(total, value opt.Float) opt.Float {
+	if !value.Exists() {
+		return total
+	}
+	return opt.FloatWith(total.ValueOr(0) + value.ValueOr(0))
+}
+
+// addUint adds an optional value to a sum, which is unset until a value is added
+func addUint(total, value opt.Uint) opt.Uint {
+	if !value.Exists() {
+		return total
+	}
+	return opt.UintWith(total.ValueOr(0) + value.ValueOr(0))
+}
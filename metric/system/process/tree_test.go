@@ -0,0 +1,89 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || linux || windows || aix || netbsd || openbsd
+// +build darwin freebsd linux windows aix netbsd openbsd
+
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+)
+
+func TestProcessTree(t *testing.T) {
+	newProc := func(pid, ppid int, pct float64, rss uint64) ProcState {
+		return ProcState{
+			Pid:        opt.IntWith(pid),
+			Ppid:       opt.IntWith(ppid),
+			CPU:        ProcCPUInfo{Total: CPUTotal{Pct: opt.FloatWith(pct)}},
+			Memory:     ProcMemInfo{Rss: MemBytePct{Bytes: opt.UintWith(rss)}},
+			FD:         ProcFDInfo{Open: opt.UintWith(10)},
+			NumThreads: opt.IntWith(2),
+		}
+	}
+
+	// 1 -> 100 (nginx master) -> 101, 102 (workers) -> 103
+	// 200's parent isn't part of the snapshot
+	tree := NewProcessTree(ProcsMap{
+		1:   newProc(1, 0, 0.1, 1000),
+		100: newProc(100, 1, 0.5, 2000),
+		101: newProc(101, 100, 1.5, 3000),
+		102: newProc(102, 100, 2, 3000),
+		103: newProc(103, 102, 1, 500),
+		200: newProc(200, 150, 3, 100),
+	})
+
+	assert.Equal(t, []int{1, 200}, tree.Roots())
+	assert.Equal(t, []int{101, 102}, tree.Children(100))
+	assert.Empty(t, tree.Children(103))
+	assert.Equal(t, []int{102, 100, 1}, tree.Ancestors(103))
+	assert.Empty(t, tree.Ancestors(200))
+	assert.Equal(t, []int{101, 102, 103}, tree.Descendants(100))
+	assert.Empty(t, tree.Descendants(999))
+
+	info, ok := tree.Subtree(100)
+	require.True(t, ok)
+	assert.Equal(t, 2, info.Children.ValueOr(0))
+	assert.Equal(t, 3, info.Descendants.ValueOr(0))
+	assert.InDelta(t, 5.0, info.CPU.Pct.ValueOr(0), 1e-9)
+	assert.Equal(t, uint64(8500), info.Memory.Rss.Bytes.ValueOr(0))
+	assert.Equal(t, uint64(40), info.FD.Open.ValueOr(0))
+	assert.Equal(t, 8, info.Threads.ValueOr(0))
+	assert.False(t, info.CPU.Norm.Pct.Exists(), "metrics no process reported should be left unset")
+
+	_, ok = tree.Subtree(999)
+	assert.False(t, ok)
+}
+
+func TestProcessTreeCycle(t *testing.T) {
+	// a PID can be reused while its old children are still around, which shouldn't hang the tree
+	tree := NewProcessTree(ProcsMap{
+		10: {Pid: opt.IntWith(10), Ppid: opt.IntWith(20)},
+		20: {Pid: opt.IntWith(20), Ppid: opt.IntWith(10)},
+	})
+
+	assert.Equal(t, []int{20}, tree.Ancestors(10))
+	assert.Equal(t, []int{20}, tree.Descendants(10))
+	info, ok := tree.Subtree(10)
+	require.True(t, ok)
+	assert.Equal(t, 1, info.Descendants.ValueOr(0))
+}
@@ -0,0 +1,163 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build freebsd || linux
+// +build freebsd linux
+
+package process
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+var (
+	userDBsMut sync.Mutex
+	// userDBs holds the user databases by hostfs root, so the parsed files are shared by all the Stats instances
+	userDBs = map[string]*userDB{}
+)
+
+// userDB resolves user and group IDs to names with the passwd and group files of a hostfs.
+// os/user would read the files of the container we run in instead.
+type userDB struct {
+	mut    sync.Mutex
+	passwd idNames
+	group  idNames
+	// nss enables lookups with os/user for IDs that are missing from the files, e.g. users from LDAP.
+	// This is only enabled if hostfs isn't set, as NSS would resolve the IDs of the container otherwise.
+	nss bool
+}
+
+// idNames maps the IDs of a passwd or group file to their names, and reloads the file when it changes.
+type idNames struct {
+	path  string
+	mtime time.Time
+	size  int64
+	names map[string]string
+}
+
+// getUserDB returns the shared user database of a hostfs
+func getUserDB(hostfs resolve.Resolver) *userDB {
+	root := hostfs.ResolveHostFS("/")
+
+	userDBsMut.Lock()
+	defer userDBsMut.Unlock()
+	if db, ok := userDBs[root]; ok {
+		return db
+	}
+	db := &userDB{
+		passwd: idNames{path: hostfs.Join("etc", "passwd")},
+		group:  idNames{path: hostfs.Join("etc", "group")},
+		nss:    !hostfs.IsSet(),
+	}
+	userDBs[root] = db
+	return db
+}
+
+// userName returns the name of a user ID, or the ID itself if it can't be resolved
+func (db *userDB) userName(uid string) string {
+	db.mut.Lock()
+	name, ok, err := db.passwd.lookup(uid)
+	db.mut.Unlock()
+	if err == nil && ok {
+		return name
+	}
+
+	if db.nss {
+		if user, err := user.LookupId(uid); err == nil {
+			return user.Username
+		}
+	}
+	return uid
+}
+
+// groupName returns the name of a group ID, or the ID itself if it can't be resolved
+func (db *userDB) groupName(gid string) string {
+	db.mut.Lock()
+	name, ok, err := db.group.lookup(gid)
+	db.mut.Unlock()
+	if err == nil && ok {
+		return name
+	}
+
+	if db.nss {
+		if group, err := user.LookupGroupId(gid); err == nil {
+			return group.Name
+		}
+	}
+	return gid
+}
+
+// lookup returns the name of an ID. The file is read again if its modification time or size changed since the last lookup.
+func (f *idNames) lookup(id string) (string, bool, error) {
+	info, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		f.names = nil
+		return "", false, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("error reading file info of %s: %w", f.path, err)
+	}
+
+	if f.names == nil || !info.ModTime().Equal(f.mtime) || info.Size() != f.size {
+		names, err := readIDNames(f.path)
+		if err != nil {
+			return "", false, err
+		}
+		f.names, f.mtime, f.size = names, info.ModTime(), info.Size()
+	}
+
+	name, ok := f.names[id]
+	return name, ok, nil
+}
+
+// readIDNames parses the names and IDs from a passwd or group file, which are the first and third fields of every line.
+// Like getpwuid(3), the first entry wins if several names have the same ID.
+func readIDNames(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	names := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 {
+			continue
+		}
+		if _, ok := names[fields[2]]; !ok {
+			names[fields[2]] = fields[0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	return names, nil
+}
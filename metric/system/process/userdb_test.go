@@ -0,0 +1,74 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build freebsd || linux
+// +build freebsd linux
+
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestUserDB(t *testing.T) {
+	root := t.TempDir()
+	etc := filepath.Join(root, "etc")
+	require.NoError(t, os.MkdirAll(etc, 0o755))
+	passwd := filepath.Join(etc, "passwd")
+	require.NoError(t, os.WriteFile(passwd, []byte("root:x:0:0:root:/root:/bin/bash\n"+
+		"# comment\n"+
+		"postgres:x:70:70::/var/lib/postgresql:/bin/sh\n"+
+		"toor:x:0:0:root:/root:/bin/bash\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(etc, "group"), []byte("root:x:0:\nwheel:x:10:postgres\n"), 0o644))
+
+	hostfs := resolve.NewTestResolver(root)
+	users := getUserDB(hostfs)
+	assert.Same(t, users, getUserDB(hostfs), "the database should be shared by hostfs")
+	assert.False(t, users.nss, "NSS would resolve the IDs of the container")
+
+	assert.Equal(t, "root", users.userName("0"), "the first entry should win")
+	assert.Equal(t, "postgres", users.userName("70"))
+	assert.Equal(t, "wheel", users.groupName("10"))
+	// unknown IDs are reported as is
+	assert.Equal(t, "1234", users.userName("1234"))
+	assert.Equal(t, "1234", users.groupName("1234"))
+
+	// the file is read again once it changes
+	require.NoError(t, os.WriteFile(passwd, []byte("root:x:0:0:root:/root:/bin/bash\nalice:x:1234:1234::/home/alice:/bin/sh\n"), 0o644))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(passwd, later, later))
+	assert.Equal(t, "alice", users.userName("1234"))
+	assert.Equal(t, "70", users.userName("70"))
+
+	// the files are optional
+	require.NoError(t, os.Remove(passwd))
+	assert.Equal(t, "0", users.userName("0"))
+}
+
+func TestUserDBNSS(t *testing.T) {
+	users := getUserDB(resolve.NewTestResolver("/"))
+	assert.True(t, users.nss)
+	assert.Equal(t, "root", users.userName("0"))
+}